@@ -1,14 +1,15 @@
 package brpc
 
 import (
+	"bufio"
 	"context"
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"github.com/bswaterb/goX/brpc/codec"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +19,19 @@ var _ io.Closer = (*Client)(nil)
 
 var ErrShutdown = errors.New("connection is shut down")
 
+// ErrNotSent marks the errors of calls which never reach the server, such calls are safe
+// to retry on another server, use errors.Is(err, ErrNotSent) to tell
+var ErrNotSent = errors.New("rpc client: call not sent")
+
+// notSentError keeps the message of err, and is also ErrNotSent
+type notSentError struct {
+	err error
+}
+
+func (e notSentError) Error() string        { return e.err.Error() }
+func (e notSentError) Unwrap() error        { return e.err }
+func (e notSentError) Is(target error) bool { return target == ErrNotSent }
+
 // Call represents an active RPC.
 type Call struct {
 	Seq           uint64
@@ -26,9 +40,17 @@ type Call struct {
 	Resp          interface{} // resp from the function
 	Error         error       // if error occurs, it will be set
 	Done          chan *Call  // Strobes when call is complete.
+	Metadata      Metadata    // sent to the server along with the request
+	ReplyMetadata Metadata    // replied by the server along with the response
+
+	deadline time.Time     // sent to the server as the remaining timeout, zero means no limit
+	stream   *ClientStream // not nil if the call is created by NewStream
 }
 
 func (call *Call) done() {
+	if call.stream != nil {
+		call.stream.finish()
+	}
 	call.Done <- call
 }
 
@@ -90,35 +112,33 @@ type Client struct {
 	pending  map[uint64]*Call
 	closing  bool // user has called Close method
 	shutdown bool // server has told us to stop
+
+	interceptors []Interceptor
 }
 
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
-	f := codec.GetCodecFuncMap()[opt.CodecType]
+	f := codec.GetCodecFunc(opt.CodecType)
 	if f == nil {
 		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
 		log.Println("rpc client: codec error:", err)
 		return nil, err
 	}
 	// send options with server
-	//jsonData, err := json.Marshal(*opt)
-	//if err != nil {
-	//	log.Println("rpc client: json option marshal error:", err)
-	//	return nil, err
-	//}
-	//jsonData = append(jsonData, '\n')
-
-	//if _, err := conn.Write(jsonData); err != nil {
-	//	log.Println("rpc client: options error: ", err)
-	//	_ = conn.Close()
-	//	return nil, err
-	//}
-
-	err := gob.NewEncoder(conn).Encode(*opt)
-	if err != nil {
+	if err := sendMessageWithDelimiter(conn, opt); err != nil {
 		log.Println("rpc client: send options error: ", err)
 		_ = conn.Close()
 		return nil, err
 	}
+	var reply handshakeReply
+	if err := receiveMessageWithDelimiter(conn, &reply); err != nil {
+		log.Println("rpc client: receive handshake reply error: ", err)
+		_ = conn.Close()
+		return nil, err
+	}
+	if !reply.Accept {
+		_ = conn.Close()
+		return nil, errors.New("rpc client: handshake rejected: " + reply.Err)
+	}
 	return newClientCodec(f(conn), opt), nil
 }
 
@@ -144,12 +164,19 @@ func parseOptions(opts ...*Option) (*Option, error) {
 	}
 	opt := opts[0]
 	opt.MagicNumber = DefaultOption.MagicNumber
+	opt.Version = DefaultOption.Version
 	if opt.CodecType == "" {
 		opt.CodecType = DefaultOption.CodecType
 	}
 	return opt, nil
 }
 
+// Use adds interceptors around every call made by Call and Go,
+// they run in the order they are added. It should be called before making calls.
+func (client *Client) Use(interceptors ...Interceptor) {
+	client.interceptors = append(client.interceptors, interceptors...)
+}
+
 // Close the connection
 func (client *Client) Close() error {
 	client.mu.Lock()
@@ -168,6 +195,13 @@ func (client *Client) IsAvailable() bool {
 	return !client.shutdown && !client.closing
 }
 
+// NumPending returns the number of calls waiting for their replies, including the open streams
+func (client *Client) NumPending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pending)
+}
+
 func (client *Client) registerCall(call *Call) (uint64, error) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
@@ -207,14 +241,30 @@ func (client *Client) receive() {
 		if err = client.cc.ReadHeader(&h); err != nil {
 			break
 		}
+		if h.Kind == codec.KindGoAway {
+			// the server is shutting down, no more call can be sent,
+			// but the pending ones will still be replied
+			client.mu.Lock()
+			client.shutdown = true
+			client.mu.Unlock()
+			err = client.cc.ReadBody(nil)
+			continue
+		}
+		if h.Kind == codec.KindStreamMsg || h.Kind == codec.KindWindowUpdate {
+			err = client.receiveStream(&h)
+			continue
+		}
 		call := client.removeCall(h.Seq)
+		if call != nil {
+			call.ReplyMetadata = h.Metadata
+		}
 		switch {
 		case call == nil:
 			// it usually means that Write partially failed
 			// and call was already removed.
 			err = client.cc.ReadBody(nil)
 		case h.Err != "":
-			call.Error = fmt.Errorf(h.Err)
+			call.Error = errorOf(&h)
 			err = client.cc.ReadBody(nil)
 			call.done()
 		default:
@@ -225,10 +275,48 @@ func (client *Client) receive() {
 			call.done()
 		}
 	}
+	// the connection is expected to be closed if the server has told us to stop
+	// or the user has closed the client, report it as ErrShutdown
+	client.mu.Lock()
+	if client.shutdown || client.closing {
+		err = ErrShutdown
+	}
+	client.mu.Unlock()
 	// error occurs, so terminateCalls pending calls
 	client.terminateCalls(err)
 }
 
+// receiveStream handles a message or a window update of a streaming call,
+// the call stays pending until its final response arrives
+func (client *Client) receiveStream(h *codec.Header) error {
+	client.mu.Lock()
+	var cs *ClientStream
+	if call := client.pending[h.Seq]; call != nil {
+		cs = call.stream
+	}
+	client.mu.Unlock()
+	if cs == nil || h.Kind == codec.KindWindowUpdate {
+		if cs != nil {
+			cs.sendWindow.release(int(h.Window))
+		}
+		return client.cc.ReadBody(nil)
+	}
+	raw := new(codec.RawBody)
+	if err := client.cc.ReadBody(raw); err != nil {
+		return err
+	}
+	if !cs.push(raw) {
+		if call := client.removeCall(h.Seq); call != nil {
+			// a writer holding client.sending may be blocked until the reader goes on,
+			// so the cancel is sent by another goroutine
+			go client.sendCancel(h.Seq)
+			call.Error = errFlowControl
+			call.done()
+		}
+	}
+	return nil
+}
+
 func (client *Client) send(call *Call) {
 	// make sure that the client will send a complete request
 	client.sending.Lock()
@@ -237,7 +325,7 @@ func (client *Client) send(call *Call) {
 	// register this call.
 	seq, err := client.registerCall(call)
 	if err != nil {
-		call.Error = err
+		call.Error = notSentError{err}
 		call.done()
 		return
 	}
@@ -246,6 +334,18 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Err = ""
+	client.header.Code = 0
+	client.header.Details = nil
+	client.header.Kind = codec.KindCall
+	client.header.Metadata = call.Metadata
+	client.header.Timeout = 0
+	if !call.deadline.IsZero() {
+		client.header.Timeout = time.Until(call.deadline)
+		if client.header.Timeout <= 0 {
+			// already expired, but 0 means no limit for the server
+			client.header.Timeout = time.Nanosecond
+		}
+	}
 
 	// encode and send the request
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
@@ -259,6 +359,16 @@ func (client *Client) send(call *Call) {
 	}
 }
 
+// sendCancel tells the server to stop handling the call with seq
+func (client *Client) sendCancel(seq uint64) {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	h := codec.Header{Seq: seq, Kind: codec.KindCancel}
+	if err := client.cc.Write(&h, nil); err != nil {
+		log.Println("rpc client: send cancel error:", err)
+	}
+}
+
 // Go invokes the function asynchronously.
 // It returns the Call structure representing the invocation.
 func (client *Client) Go(serviceMethod string, args, resp any, done chan *Call) *Call {
@@ -273,28 +383,92 @@ func (client *Client) Go(serviceMethod string, args, resp any, done chan *Call)
 		Resp:          resp,
 		Done:          done,
 	}
+	if len(client.interceptors) > 0 {
+		// interceptors wrap a synchronous call, so run it in background
+		go func() {
+			ctx := WithReplyMetadata(context.Background(), &call.ReplyMetadata)
+			call.Error = client.Call(ctx, serviceMethod, args, resp)
+			call.done()
+		}()
+		return call
+	}
 	client.send(call)
 	return call
 }
 
 // Call invokes the named function, waits for it to complete,
 // and returns its error status.
+// The deadline of ctx is sent to the server, and the server is told
+// to stop handling the call once ctx is done before the call completes.
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply any) error {
-	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	if len(client.interceptors) == 0 {
+		return client.call(ctx, serviceMethod, args, reply)
+	}
+	return ChainInterceptors(client.interceptors, client.call)(ctx, serviceMethod, args, reply)
+}
+
+func (client *Client) call(ctx context.Context, serviceMethod string, args, reply any) error {
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Resp:          reply,
+		Done:          make(chan *Call, 1),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		call.deadline = deadline
+	}
+	call.Metadata, _ = FromOutgoingContext(ctx)
+	client.send(call)
 	select {
 	case <-ctx.Done():
-		client.removeCall(call.Seq)
-		return errors.New("rpc client: call failed: " + ctx.Err().Error())
+		if client.removeCall(call.Seq) != nil {
+			client.sendCancel(call.Seq)
+		}
+		return callFailed(ctx)
 	case callRes := <-call.Done:
+		if md, ok := ctx.Value(replyReceiverKey{}).(*Metadata); ok {
+			*md = callRes.ReplyMetadata
+		}
 		return callRes.Error
 	}
 }
 
+// NewHTTPClient new a Client instance via HTTP as transport protocol
+func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
+	_, _ = io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.0\n\n", DefaultRPCPath))
+
+	// Require successful HTTP response before switching to RPC protocol.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err == nil && resp.Status == connected {
+		return NewClient(conn, opt)
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	return nil, err
+}
+
+// DialHTTP connects to an HTTP RPC server at the specified network address
+// listening on the default HTTP RPC path.
+func DialHTTP(network, address string, opts ...*Option) (*Client, error) {
+	return dialTimeout(NewHTTPClient, network, address, opts...)
+}
+
+// XDial calls different functions to connect to a RPC server
+// according the first parameter rpcAddr.
+// rpcAddr is a general format (protocol@addr) to represent a rpc server
+// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, unix@/tmp/brpc.sock
 func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
 	parts := strings.Split(rpcAddr, "@")
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
 	}
 	protocol, addr := parts[0], parts[1]
-	return Dial(protocol, addr, opts...)
+	switch protocol {
+	case "http":
+		return DialHTTP("tcp", addr, opts...)
+	default:
+		// tcp, unix or other transport protocol
+		return Dial(protocol, addr, opts...)
+	}
 }
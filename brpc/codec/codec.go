@@ -1,8 +1,11 @@
 package codec
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"time"
 )
 
 const (
@@ -14,26 +17,61 @@ var (
 	TypeGobBytes = []byte("application/gob#")
 )
 
-var defaultCodecFuncMap map[Type]NewCodecFunc
-var once sync.Once
+var (
+	codecFuncMap = make(map[Type]NewCodecFunc)
+	codecMu      sync.RWMutex
+)
+
+func init() {
+	_ = Register(TypeGob, NewGobCodec)
+	_ = Register(TypeJson, NewJsonCodec)
+}
+
+// Register 注册一种编解码协议，可在第三方包的 init() 中调用，同一 Type 只能注册一次。
+// f 返回的 Codec 需要基于 NewFrameCodec 才能用于流式调用，见 Codec
+func Register(t Type, f NewCodecFunc) error {
+	if t == "" || f == nil {
+		return errors.New("rpc codec: register with empty type or nil NewCodecFunc")
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	if _, dup := codecFuncMap[t]; dup {
+		return fmt.Errorf("rpc codec: codec type %s already registered", t)
+	}
+	codecFuncMap[t] = f
+	return nil
+}
 
+// GetCodecFunc 返回 t 对应的构造函数，未注册时返回 nil
+func GetCodecFunc(t Type) NewCodecFunc {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	return codecFuncMap[t]
+}
+
+// GetCodecFuncMap 返回当前已注册协议的一份拷贝
 func GetCodecFuncMap() map[Type]NewCodecFunc {
-	once.Do(func() {
-		defaultCodecFuncMap = make(map[Type]NewCodecFunc)
-		defaultCodecFuncMap[TypeGob] = NewGobCodec
-	})
-	return defaultCodecFuncMap
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	m := make(map[Type]NewCodecFunc, len(codecFuncMap))
+	for t, f := range codecFuncMap {
+		m[t] = f
+	}
+	return m
 }
 
 type Type string
 
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 
+// Codec 读写一个连接上的消息。
+// 流式调用要求 ReadBody 支持 *RawBody 以延迟解码，目前只有 NewFrameCodec 创建的 Codec 支持，
+// 通过 Register 注册的第三方协议应当基于 NewFrameCodec 实现（只提供 Marshaler），否则只能用于普通调用
 type Codec interface {
 	io.Closer
 	// ReadHeader 从 io.Reader 中读取协议头
 	ReadHeader(*Header) error
-	// ReadBody 从 io.Reader 中读取请求体
+	// ReadBody 从 io.Reader 中读取请求体，body 为 nil 时丢弃，为 *RawBody 时只保存原始数据
 	ReadBody(interface{}) error
 	// Write 向 io.Writer 写入响应的 header 和 body
 	Write(*Header, interface{}) error
@@ -41,6 +79,24 @@ type Codec interface {
 	GetCC() io.ReadWriteCloser
 }
 
+// Kind 标识消息的类型
+type Kind uint8
+
+const (
+	// KindCall 普通的请求与响应
+	KindCall Kind = iota
+	// KindCancel 客户端放弃 Seq 对应的请求，服务端应停止处理
+	KindCancel
+	// KindGoAway 服务端即将关闭，客户端不应再发送新的请求，已发出的请求仍会得到响应
+	KindGoAway
+	// KindStreamMsg 流式调用中的一条消息，两个方向都会使用
+	KindStreamMsg
+	// KindStreamEnd 客户端不再发送流消息，服务端的结束由最终的响应表示
+	KindStreamEnd
+	// KindWindowUpdate 接收方消费了消息，允许对端再发送 Window 条
+	KindWindowUpdate
+)
+
 type Header struct {
 	// 请求的具体服务与方法
 	ServiceMethod string
@@ -48,4 +104,15 @@ type Header struct {
 	Seq uint64
 	// 被调用方报错
 	Err string
+	// 错误类别与附加信息，见 brpc.Error
+	Code    uint32
+	Details map[string]string
+	// 消息类型，零值表示普通的请求/响应
+	Kind Kind
+	// 客户端剩余的超时时间，0 表示不限，使用相对时长以避免两端时钟不一致
+	Timeout time.Duration
+	// 元数据，请求中为客户端设置的信息，响应中为服务端回传的信息
+	Metadata map[string]string
+	// 流控窗口增量，仅用于 KindWindowUpdate
+	Window uint32
 }
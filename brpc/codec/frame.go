@@ -0,0 +1,168 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// 每条消息都以定长的前缀开头，之后紧跟 header 与 body 两段数据
+// [magic 2B][version 1B][header len 4B][body len 4B][<- Header ->][<- Body ->]
+// 前缀中的整数均为大端序，header 与 body 的编码方式由 Marshaler 决定
+const (
+	FrameMagic     uint16 = 0xb7c1
+	FrameVersion   uint8  = 1
+	FramePrefixLen        = 11
+	// MaxFrameLen 限制单段数据的长度，避免异常的长度字段导致超大内存分配
+	MaxFrameLen = 64 << 20
+)
+
+var ErrInvalidFrame = errors.New("rpc codec: invalid frame")
+
+// Marshaler 负责单条消息的编解码，帧的拆分由 FrameCodec 完成
+type Marshaler interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// ReadFrame 读出一个完整的帧，返回其中的 header 与 body 原始数据
+// 代理等中间层可以借此转发消息而无需解码
+func ReadFrame(r io.Reader) (header, body []byte, err error) {
+	var prefix [FramePrefixLen]byte
+	if _, err = io.ReadFull(r, prefix[:]); err != nil {
+		return nil, nil, err
+	}
+	if binary.BigEndian.Uint16(prefix[0:2]) != FrameMagic {
+		return nil, nil, fmt.Errorf("%w: bad magic %#x", ErrInvalidFrame, prefix[0:2])
+	}
+	if prefix[2] != FrameVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFrame, prefix[2])
+	}
+	headerLen := binary.BigEndian.Uint32(prefix[3:7])
+	bodyLen := binary.BigEndian.Uint32(prefix[7:11])
+	if headerLen > MaxFrameLen || bodyLen > MaxFrameLen {
+		return nil, nil, fmt.Errorf("%w: length %d/%d exceeds limit", ErrInvalidFrame, headerLen, bodyLen)
+	}
+	data := make([]byte, headerLen+bodyLen)
+	if _, err = io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return data[:headerLen], data[headerLen:], nil
+}
+
+// WriteFrame 将 header 与 body 以帧的格式写入 w
+func WriteFrame(w io.Writer, header, body []byte) error {
+	if len(header) > MaxFrameLen || len(body) > MaxFrameLen {
+		return fmt.Errorf("%w: length %d/%d exceeds limit", ErrInvalidFrame, len(header), len(body))
+	}
+	var prefix [FramePrefixLen]byte
+	binary.BigEndian.PutUint16(prefix[0:2], FrameMagic)
+	prefix[2] = FrameVersion
+	binary.BigEndian.PutUint32(prefix[3:7], uint32(len(header)))
+	binary.BigEndian.PutUint32(prefix[7:11], uint32(len(body)))
+	for _, b := range [][]byte{prefix[:], header, body} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FrameCodec 在帧格式之上实现 Codec，每个帧独立解码，
+// 因此某个 body 解码失败只影响它所属的请求，不会破坏后续的消息
+type FrameCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	buf  *bufio.Writer
+	m    Marshaler
+	// body 保存 ReadHeader 时一并读出的 body 数据，等待 ReadBody 解码
+	body []byte
+}
+
+func NewFrameCodec(conn io.ReadWriteCloser, m Marshaler) Codec {
+	return newFrameCodec(conn, m)
+}
+
+func newFrameCodec(conn io.ReadWriteCloser, m Marshaler) *FrameCodec {
+	return &FrameCodec{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		buf:  bufio.NewWriter(conn),
+		m:    m,
+	}
+}
+
+func (c *FrameCodec) ReadHeader(h *Header) error {
+	header, body, err := ReadFrame(c.r)
+	if err != nil {
+		return err
+	}
+	c.body = body
+	return c.m.Unmarshal(header, h)
+}
+
+// RawBody 用于延迟解码：ReadBody 传入 *RawBody 时只保存原始数据，稍后再按需要的类型解码，
+// 流式调用的读循环并不知道消息的类型，借此把解码推迟到 Recv 时
+type RawBody struct {
+	data []byte
+	m    Marshaler
+}
+
+// Decode 将保存的数据解码到 v，空的数据表示对端发送的是 nil
+func (b *RawBody) Decode(v any) error {
+	if v == nil || len(b.data) == 0 {
+		return nil
+	}
+	return b.m.Unmarshal(b.data, v)
+}
+
+func (c *FrameCodec) ReadBody(body interface{}) error {
+	data := c.body
+	c.body = nil
+	if raw, ok := body.(*RawBody); ok {
+		raw.data, raw.m = data, c.m
+		return nil
+	}
+	// body 为 nil 表示丢弃，空的 body 表示对端发送的是 nil
+	if body == nil || len(data) == 0 {
+		return nil
+	}
+	return c.m.Unmarshal(data, body)
+}
+
+func (c *FrameCodec) Write(h *Header, body any) error {
+	header, err := c.m.Marshal(h)
+	if err != nil {
+		log.Println("rpc codec: error encoding header:", err)
+		return err
+	}
+	var data []byte
+	if body != nil {
+		if data, err = c.m.Marshal(body); err != nil {
+			log.Println("rpc codec: error encoding body:", err)
+			return err
+		}
+	}
+	// 编码失败时尚未写出任何数据，连接仍然可用；写入失败则说明连接已不可信
+	if err = WriteFrame(c.buf, header, data); err == nil {
+		err = c.buf.Flush()
+	}
+	if err != nil {
+		_ = c.Close()
+	}
+	return err
+}
+
+func (c *FrameCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *FrameCodec) GetCC() io.ReadWriteCloser {
+	return c.conn
+}
@@ -1,71 +1,32 @@
 package codec
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/gob"
 	"io"
-	"log"
 )
 
-type GobCodec struct {
-	conn io.ReadWriteCloser
-	// buf 考虑提供快捷返回的方法，在 enc 过程中只要成功把数据写入 buf 中就予以响应成功
-	buf *bufio.Writer
-	dec *gob.Decoder
-	enc *gob.Encoder
-}
-
-func NewGobCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
-	return &GobCodec{
-		conn: conn,
-		buf:  buf,
-		dec:  gob.NewDecoder(conn),
-		enc:  gob.NewEncoder(buf),
-	}
-}
-
-func (c *GobCodec) ReadHeader(h *Header) error {
-	err := c.dec.Decode(h)
-	log.Printf("gob codec info: reading header, codec:%#v\n", c.conn)
-	return err
-}
+// gobMarshaler 每条消息使用独立的 gob 流，类型信息随消息一起发送，
+// 这样每个帧都可以单独解码
+type gobMarshaler struct{}
 
-func (c *GobCodec) ReadBody(body interface{}) error {
-	return c.dec.Decode(body)
-}
-
-func (c *GobCodec) Write(h *Header, body any) error {
-	var err error
-	defer func() {
-		_ = c.buf.Flush()
-		if err != nil {
-			_ = c.Close()
-		}
-	}()
+func (gobMarshaler) Marshal(v any) ([]byte, error) {
 	var buf bytes.Buffer
-	_ = gob.NewEncoder(&buf).Encode(h)
-	if err = c.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
-		return err
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	_ = gob.NewEncoder(&buf).Encode(body)
-
-	// fmt.Printf("原始内容：%#v, %#v, gob encode result: %v\n\n", h, body, buf.Bytes())
-
-	if err = c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
-		return err
-	}
-	return nil
+func (gobMarshaler) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
 }
 
-func (c *GobCodec) Close() error {
-	return c.conn.Close()
+// GobCodec 以帧格式收发消息，header 与 body 使用 gob 编码
+type GobCodec struct {
+	*FrameCodec
 }
 
-func (c *GobCodec) GetCC() io.ReadWriteCloser {
-	return c.conn
+func NewGobCodec(conn io.ReadWriteCloser) Codec {
+	return &GobCodec{newFrameCodec(conn, gobMarshaler{})}
 }
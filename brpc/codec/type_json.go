@@ -0,0 +1,25 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonMarshaler struct{}
+
+func (jsonMarshaler) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonMarshaler) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// JsonCodec 以帧格式收发消息，header 与 body 使用 json 编码
+type JsonCodec struct {
+	*FrameCodec
+}
+
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	return &JsonCodec{newFrameCodec(conn, jsonMarshaler{})}
+}
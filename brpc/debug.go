@@ -0,0 +1,108 @@
+package brpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+const DefaultDebugPath = "/debug/brpc"
+
+const debugText = `<html>
+	<body>
+	<title>brpc Services</title>
+	{{range .}}
+	<hr>
+	Service {{.Name}}
+	<hr>
+		<table>
+		<th align=center>Method</th><th align=center>Calls</th>
+		{{range .Methods}}
+			<tr>
+			<td align=left font=fixed>{{.Name}}({{.ArgType}}{{if .ReplyType}}, {{.ReplyType}}{{end}}) error</td>
+			<td align=center>{{.Calls}}</td>
+			</tr>
+		{{end}}
+		</table>
+	{{end}}
+	</body>
+	</html>`
+
+var debug = template.Must(template.New("brpc debug").Parse(debugText))
+
+type debugMethod struct {
+	Name      string
+	ArgType   string
+	ReplyType string
+	Calls     uint64
+}
+
+type debugService struct {
+	Name    string
+	Methods []debugMethod
+}
+
+type debugHTTP struct {
+	*Server
+}
+
+// DebugHandler returns the handler of debug page, mount it on your own mux if HandleHTTP is not used
+func (server *Server) DebugHandler() http.Handler {
+	return debugHTTP{server}
+}
+
+// Runs at /debug/brpc, add "?format=json" for a json response
+func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	services := server.debugServices()
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(services); err != nil {
+			_, _ = fmt.Fprintln(w, "rpc: error executing json:", err.Error())
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := debug.Execute(w, services); err != nil {
+		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
+	}
+}
+
+// paramName returns the name of a parameter type, nil is the place of *ServerStream.
+// Bidi-streaming methods take the stream only, so the reply is left empty.
+func paramName(t reflect.Type, isParam bool) string {
+	switch {
+	case t != nil:
+		return t.String()
+	case isParam:
+		return typeOfServerStream.String()
+	}
+	return ""
+}
+
+// debugServices collects all registered services, sorted by name
+func (server *Server) debugServices() []debugService {
+	var services []debugService
+	server.serviceMap.Range(func(namei, svci interface{}) bool {
+		if isReserved(namei.(string)) {
+			return true
+		}
+		svc := svci.(*service)
+		ds := debugService{Name: namei.(string)}
+		for name, mtype := range svc.method {
+			ds.Methods = append(ds.Methods, debugMethod{
+				Name:      name,
+				ArgType:   paramName(mtype.ArgType, true),
+				ReplyType: paramName(mtype.RespType, mtype.StreamKind != BidiStreaming),
+				Calls:     mtype.NumCalls(),
+			})
+		}
+		sort.Slice(ds.Methods, func(i, j int) bool { return ds.Methods[i].Name < ds.Methods[j].Name })
+		services = append(services, ds)
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
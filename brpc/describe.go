@@ -0,0 +1,149 @@
+package brpc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReservedService is the name of the built-in service of every Server, user services can't take it.
+// It offers "_brpc.Describe", which replies what the server offers, see Describe.
+const ReservedService = "_brpc"
+
+// DescribeArgs is the args of _brpc.Describe
+type DescribeArgs struct {
+	// Service limits the reply to the named service, empty means all
+	Service string
+}
+
+// DescribeReply is the reply of _brpc.Describe
+type DescribeReply struct {
+	Services []ServiceDesc
+}
+
+// ServiceDesc describes a registered service
+type ServiceDesc struct {
+	Name    string
+	Methods []MethodDesc
+}
+
+// MethodDesc describes a method, ArgType or ReplyType is nil
+// where the method takes the *ServerStream, see StreamKind
+type MethodDesc struct {
+	Name       string
+	StreamKind StreamKind
+	ArgType    *TypeDesc
+	ReplyType  *TypeDesc
+}
+
+// TypeDesc describes the structure of a type
+type TypeDesc struct {
+	Name string // as reflect.Type.String, such as "*main.Args"
+	Kind string // as reflect.Kind.String, such as "struct", "ptr", "map"
+	// Elem is the element of ptr, slice, array and map types, Key is the key of map types
+	Elem *TypeDesc
+	Key  *TypeDesc
+	// Fields are the exported fields of struct types,
+	// they are left empty where a struct refers to itself
+	Fields []FieldDesc
+}
+
+// FieldDesc describes a field of a struct
+type FieldDesc struct {
+	Name string
+	Tag  string
+	Type *TypeDesc
+}
+
+// Describe asks the server behind c what it offers, service limits the reply
+// to the named service, empty means all
+func Describe(ctx context.Context, c Caller, service string) ([]ServiceDesc, error) {
+	var reply DescribeReply
+	if err := c.Call(ctx, ReservedService+".Describe", &DescribeArgs{Service: service}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Services, nil
+}
+
+// newReservedService returns the built-in service of server
+func newReservedService(server *Server) *service {
+	describe := &methodType{
+		ArgType:  reflect.TypeOf(DescribeArgs{}),
+		RespType: reflect.TypeOf(&DescribeReply{}),
+		withCtx:  true,
+		fn: &funcMethod{
+			newArg:   func() any { return new(DescribeArgs) },
+			argOf:    func(argp any) any { return *argp.(*DescribeArgs) },
+			newReply: func() any { return new(DescribeReply) },
+			call: func(ctx context.Context, argv, reply any) error {
+				return server.describe(argv.(DescribeArgs), reply.(*DescribeReply))
+			},
+		},
+	}
+	return &service{name: ReservedService, method: map[string]*methodType{"Describe": describe}}
+}
+
+func (server *Server) describe(args DescribeArgs, reply *DescribeReply) error {
+	server.serviceMap.Range(func(namei, svci interface{}) bool {
+		name := namei.(string)
+		if isReserved(name) || args.Service != "" && args.Service != name {
+			return true
+		}
+		svc := svci.(*service)
+		sd := ServiceDesc{Name: name}
+		for mname, mtype := range svc.method {
+			sd.Methods = append(sd.Methods, MethodDesc{
+				Name:       mname,
+				StreamKind: mtype.StreamKind,
+				ArgType:    describeType(mtype.ArgType, nil),
+				ReplyType:  describeType(mtype.RespType, nil),
+			})
+		}
+		sort.Slice(sd.Methods, func(i, j int) bool { return sd.Methods[i].Name < sd.Methods[j].Name })
+		reply.Services = append(reply.Services, sd)
+		return true
+	})
+	if args.Service != "" && len(reply.Services) == 0 {
+		return Errorf(NotFound, "rpc server: can't find service %s", args.Service)
+	}
+	sort.Slice(reply.Services, func(i, j int) bool { return reply.Services[i].Name < reply.Services[j].Name })
+	return nil
+}
+
+// describeType describes t, seen holds the structs being described to stop at recursive types
+func describeType(t reflect.Type, seen map[reflect.Type]bool) *TypeDesc {
+	if t == nil {
+		return nil
+	}
+	td := &TypeDesc{Name: t.String(), Kind: t.Kind().String()}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		td.Elem = describeType(t.Elem(), seen)
+	case reflect.Map:
+		td.Key = describeType(t.Key(), seen)
+		td.Elem = describeType(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return td
+		}
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			td.Fields = append(td.Fields, FieldDesc{Name: f.Name, Tag: string(f.Tag), Type: describeType(f.Type, seen)})
+		}
+		delete(seen, t)
+	}
+	return td
+}
+
+// isReserved reports whether name is taken by the server itself
+func isReserved(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
@@ -0,0 +1,79 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bswaterb/goX/brpc/codec"
+)
+
+type Node struct {
+	Val      int `json:"val"`
+	Next     *Node
+	Children map[string][]Node
+	hidden   int
+}
+
+type Tree struct{}
+
+func (t Tree) Len(n Node, reply *int) error {
+	for p := &n; p != nil; p = p.Next {
+		*reply++
+	}
+	return nil
+}
+
+func TestServer_Describe(t *testing.T) {
+	server := NewServer()
+	_assert(server.Register(new(Foo)) == nil, "failed to register Foo")
+	_assert(server.Register(&Streamer{}) == nil, "failed to register Streamer")
+	_assert(server.Register(Tree{}) == nil, "failed to register Tree")
+	_assert(RegisterFunc(server, "Calc.Add", sum) == nil, "failed to register Calc.Add")
+	_assert(RegisterFunc(server, ReservedService+".Add", sum) != nil, "reserved service should be refused")
+	addr := serveTestServer(t, server)
+
+	for _, typ := range []codec.Type{codec.TypeGob, codec.TypeJson} {
+		client, err := Dial("tcp", addr, &Option{CodecType: typ})
+		_assert(err == nil, "%s: dial error: %v", typ, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+		services, err := Describe(ctx, client, "")
+		_assert(err == nil, "%s: failed to describe: %v", typ, err)
+		var names []string
+		for _, sd := range services {
+			names = append(names, sd.Name)
+		}
+		_assert(len(names) == 4 && names[0] == "Calc" && names[1] == "Foo" && names[2] == "Streamer" && names[3] == "Tree",
+			"%s: unexpected services %v", typ, names)
+
+		m := services[1].Methods[0]
+		_assert(m.Name == "Sum" && m.StreamKind == Unary && m.ArgType.Name == "brpc.Args" && m.ArgType.Kind == "struct",
+			"%s: unexpected method %+v", typ, m)
+		_assert(len(m.ArgType.Fields) == 2 && m.ArgType.Fields[0].Name == "Num1" && m.ArgType.Fields[0].Type.Kind == "int",
+			"%s: unexpected args %+v", typ, m.ArgType)
+		_assert(m.ReplyType.Kind == "ptr" && m.ReplyType.Elem.Name == "int", "%s: unexpected reply %+v", typ, m.ReplyType)
+
+		count := services[2].Methods[0]
+		_assert(count.Name == "Count" && count.StreamKind == ServerStreaming && count.ArgType.Name == "int" && count.ReplyType == nil,
+			"%s: unexpected stream method %+v", typ, count)
+
+		node := services[3].Methods[0].ArgType
+		_assert(len(node.Fields) == 3 && node.Fields[0].Tag == `json:"val"`, "%s: unexpected fields %+v", typ, node.Fields)
+		next := node.Fields[1].Type
+		_assert(next.Kind == "ptr" && next.Elem.Name == "brpc.Node" && len(next.Elem.Fields) == 0,
+			"%s: recursive type should stop, got %+v", typ, next.Elem)
+		children := node.Fields[2].Type
+		_assert(children.Key.Kind == "string" && children.Elem.Kind == "slice" && children.Elem.Elem.Name == "brpc.Node",
+			"%s: unexpected map %+v", typ, children)
+
+		services, err = Describe(ctx, client, "Calc")
+		_assert(err == nil && len(services) == 1 && services[0].Methods[0].Name == "Add", "%s: failed to describe Calc: %v", typ, err)
+		_, err = Describe(ctx, client, "Unknown")
+		_assert(errors.Is(err, NotFound), "%s: expect NotFound, got %v", typ, err)
+
+		cancel()
+		_ = client.Close()
+	}
+}
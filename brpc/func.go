@@ -0,0 +1,74 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// funcMethod 是 RegisterFunc 注册的方法，参数的创建与方法的调用都由泛型函数完成，不经过反射
+type funcMethod struct {
+	newArg   func() any
+	argOf    func(argp any) any
+	newReply func() any
+	call     func(ctx context.Context, argv, reply any) error
+}
+
+// RegisterFunc publishes fn in server as serviceMethod, in the format "<service>.<method>".
+// Unlike Register, the method is dispatched without reflection.
+// The service may also hold methods published by Register, before or after RegisterFunc,
+// and other RegisterFunc calls, but the same method can't be published twice.
+// It should be called before serving.
+func RegisterFunc[A, R any](server *Server, serviceMethod string, fn func(ctx context.Context, args A, reply *R) error) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot <= 0 || dot == len(serviceMethod)-1 {
+		return errors.New("rpc: service/method ill-formed: " + serviceMethod)
+	}
+	if fn == nil {
+		return errors.New("rpc: nil func for " + serviceMethod)
+	}
+	if isReserved(serviceMethod[:dot]) {
+		return errors.New("rpc: service name is reserved: " + serviceMethod[:dot])
+	}
+	m := &methodType{
+		// the types are only used for describing the method
+		ArgType:  reflect.TypeOf((*A)(nil)).Elem(),
+		RespType: reflect.TypeOf((*R)(nil)),
+		withCtx:  true,
+		fn: &funcMethod{
+			newArg:   func() any { return new(A) },
+			argOf:    func(argp any) any { return *argp.(*A) },
+			newReply: func() any { return new(R) },
+			call: func(ctx context.Context, argv, reply any) error {
+				// argv is nil if A is an interface type and the client sent nil
+				args, _ := argv.(A)
+				return fn(ctx, args, reply.(*R))
+			},
+		},
+	}
+	return server.addMethod(serviceMethod[:dot], serviceMethod[dot+1:], m)
+}
+
+// addMethod publishes m in the service serviceName, which is created if it doesn't exist.
+// Services are read without lock while serving, so a modified copy is stored instead.
+func (server *Server) addMethod(serviceName, methodName string, m *methodType) error {
+	server.registerMu.Lock()
+	defer server.registerMu.Unlock()
+	svc := &service{name: serviceName, method: make(map[string]*methodType)}
+	if svci, ok := server.serviceMap.Load(serviceName); ok {
+		old := svci.(*service)
+		if _, dup := old.method[methodName]; dup {
+			return errors.New("rpc: method already defined: " + serviceName + "." + methodName)
+		}
+		svc.objType, svc.regObj = old.objType, old.regObj
+		for name, mtype := range old.method {
+			svc.method[name] = mtype
+		}
+	}
+	svc.method[methodName] = m
+	server.serviceMap.Store(serviceName, svc)
+	log.Printf("rpc server: register %s.%s\n", serviceName, methodName)
+	return nil
+}
@@ -0,0 +1,112 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bswaterb/goX/brpc/codec"
+)
+
+func sum(ctx context.Context, args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestRegisterFunc(t *testing.T) {
+	server := NewServer()
+	_assert(server.Register(new(Foo)) == nil, "failed to register Foo")
+	_assert(RegisterFunc(server, "Calc.Add", sum) == nil, "failed to register Calc.Add")
+	// a func can be added to a service published by Register
+	mul := func(ctx context.Context, args *Args, reply *int) error {
+		*reply = args.Num1 * args.Num2
+		return nil
+	}
+	_assert(RegisterFunc(server, "Foo.Mul", mul) == nil, "failed to register Foo.Mul")
+	_assert(RegisterFunc(server, "Foo.Sum", sum) != nil, "Foo.Sum should not be registered twice")
+	_assert(RegisterFunc(server, "Calc", sum) != nil, "ill-formed name should be refused")
+	_assert(server.Register(new(Foo)) != nil, "Foo should not be registered twice")
+	// the funcs published first are kept by Register
+	_assert(RegisterFunc(server, "Sleeper.Add", sum) == nil, "failed to register Sleeper.Add")
+	_assert(server.Register(Sleeper{}) == nil, "failed to register Sleeper after Sleeper.Add")
+	svc, _, err := server.findService("Sleeper.Add")
+	_assert(err == nil && len(svc.method) == 2, "expect Sleeper.Add and Sleeper.Sleep, got %v", err)
+	_assert(RegisterFunc(server, "Echo.Panic", sum) == nil, "failed to register Echo.Panic")
+	err = server.Register(Echo{})
+	_assert(err != nil && strings.Contains(err.Error(), "method already defined: Echo.Panic"),
+		"Echo.Panic should not be published twice, got %v", err)
+	// the clash leaves the service as it was
+	svc, _, err = server.findService("Echo.Panic")
+	_assert(err == nil && len(svc.method) == 1 && svc.objType == nil, "expect only the func Echo.Panic, got %v", err)
+	_, _, err = server.findService("Echo.Fail")
+	_assert(err != nil, "Echo.Fail should not be published")
+	var nilFunc func(context.Context, Args, *int) error
+	_assert(RegisterFunc(server, "Calc.Nil", nilFunc) != nil, "nil func should be refused")
+
+	var calls []string
+	server.Use(func(ctx context.Context, serviceMethod string, args, reply any, next Invoker) error {
+		calls = append(calls, serviceMethod)
+		return next(ctx, serviceMethod, args, reply)
+	})
+	addr := serveTestServer(t, server)
+
+	for _, typ := range []codec.Type{codec.TypeGob, codec.TypeJson} {
+		client, err := Dial("tcp", addr, &Option{CodecType: typ})
+		_assert(err == nil, "%s: dial error: %v", typ, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		var reply int
+		err = client.Call(ctx, "Calc.Add", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "%s: failed to call Calc.Add: %v", typ, err)
+		err = client.Call(ctx, "Foo.Mul", &Args{Num1: 3, Num2: 4}, &reply)
+		_assert(err == nil && reply == 12, "%s: failed to call Foo.Mul: %v", typ, err)
+		err = client.Call(ctx, "Foo.Sum", Args{Num1: 5, Num2: 6}, &reply)
+		_assert(err == nil && reply == 11, "%s: failed to call Foo.Sum: %v", typ, err)
+		cancel()
+		_ = client.Close()
+	}
+	_assert(strings.Join(calls, ",") == "Calc.Add,Foo.Mul,Foo.Sum,Calc.Add,Foo.Mul,Foo.Sum",
+		"interceptors should run for funcs too, got %v", calls)
+
+	svc, mtype, err := server.findService("Calc.Add")
+	_assert(err == nil && svc.name == "Calc" && mtype.NumCalls() == 2, "expect 2 calls of Calc.Add")
+}
+
+func TestRegisterFunc_Error(t *testing.T) {
+	server := NewServer()
+	fail := func(ctx context.Context, args any, reply *struct{}) error {
+		_assert(args == nil, "expect nil args, got %v", args)
+		return Errorf(InvalidArgument, "bad")
+	}
+	_assert(RegisterFunc(server, "Calc.Fail", fail) == nil, "failed to register Calc.Fail")
+	addr := serveTestServer(t, server)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	err = client.Call(context.Background(), "Calc.Fail", nil, &struct{}{})
+	_assert(errors.Is(err, InvalidArgument), "expect InvalidArgument, got %v", err)
+}
+
+// BenchmarkService_Invoke compares the dispatch of a method published by Register and by RegisterFunc,
+// including the creation of args and reply done for every request
+func BenchmarkService_Invoke(b *testing.B) {
+	server := NewServer()
+	_ = server.Register(new(Foo))
+	_ = RegisterFunc(server, "Calc.Add", sum)
+	ctx := context.Background()
+	for _, name := range []string{"Foo.Sum", "Calc.Add"} {
+		svc, mtype, _ := server.findService(name)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				argp := mtype.newArg()
+				*argp.(*Args) = Args{Num1: i, Num2: 1}
+				reply := mtype.newReply()
+				if err := svc.invoke(ctx, mtype, mtype.argOf(argp), reply); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
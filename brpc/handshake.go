@@ -0,0 +1,58 @@
+package brpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// maxHandshakeLen 限制握手消息的长度，避免对端不发送换行符时无限读取
+const maxHandshakeLen = 4096
+
+// handshakeReply 服务端收到 Option 后的应答，客户端据此判断协商是否成功
+type handshakeReply struct {
+	Accept bool
+	Err    string `json:",omitempty"`
+}
+
+// sendMessageWithDelimiter 将 data 编码为一行 json 写入 w
+func sendMessageWithDelimiter(w io.Writer, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(jsonData, '\n'))
+	return err
+}
+
+// byteReader reads one byte at a time, so that nothing after the handshake is read ahead
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
+
+// receiveMessageWithDelimiter 读取一行 json 并解码到 data
+// 这里逐字节读取而不使用 bufio，保证不会多读走属于后续帧的数据
+func receiveMessageWithDelimiter(r io.Reader, data interface{}) error {
+	jsonData := make([]byte, 0, 128)
+	br := byteReader{r}
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			break
+		}
+		if len(jsonData) >= maxHandshakeLen {
+			return errors.New("handshake message too long")
+		}
+		jsonData = append(jsonData, b)
+	}
+	return json.Unmarshal(jsonData, data)
+}
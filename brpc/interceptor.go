@@ -0,0 +1,24 @@
+package brpc
+
+import "context"
+
+// Invoker performs a call, it's the service method on the server side,
+// and sending the request then waiting for the response on the client side
+type Invoker func(ctx context.Context, serviceMethod string, args, reply any) error
+
+// Interceptor wraps every call like the middlewares of bttp,
+// it calls next to go on with the rest of the chain, or returns directly to abort the call
+type Interceptor func(ctx context.Context, serviceMethod string, args, reply any, next Invoker) error
+
+// ChainInterceptors builds an Invoker which runs interceptors in order and then final,
+// it is shared by Server, Client and xclient.XClient
+func ChainInterceptors(interceptors []Interceptor, final Invoker) Invoker {
+	invoker := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, serviceMethod string, args, reply any) error {
+			return interceptor(ctx, serviceMethod, args, reply, next)
+		}
+	}
+	return invoker
+}
@@ -0,0 +1,69 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServer_Use(t *testing.T) {
+	var foo Foo
+	server := NewServer()
+	_assert(server.Register(&foo) == nil, "failed to register Foo")
+
+	var trace []string
+	server.Use(func(ctx context.Context, serviceMethod string, args, reply any, next Invoker) error {
+		trace = append(trace, "log:"+serviceMethod)
+		err := next(ctx, serviceMethod, args, reply)
+		trace = append(trace, "log done")
+		return err
+	}, func(ctx context.Context, serviceMethod string, args, reply any, next Invoker) error {
+		if md, _ := FromIncomingContext(ctx); md["token"] != "secret" {
+			return errors.New("unauthenticated")
+		}
+		// interceptors see the decoded args and may touch the reply after next
+		_assert(args.(Args).Num1 == 1, "unexpected args %v", args)
+		err := next(ctx, serviceMethod, args, reply)
+		*reply.(*int) *= 10
+		return err
+	})
+
+	addr := serveTestServer(t, server)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "unauthenticated"), "expect unauthenticated, got %v", err)
+
+	ctx := AppendToOutgoingContext(context.Background(), "token", "secret")
+	err = client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 30, "expect 30, got %d, %v", reply, err)
+	_assert(strings.Join(trace, ",") == "log:Foo.Sum,log done,log:Foo.Sum,log done", "unexpected trace %v", trace)
+}
+
+func TestClient_Use(t *testing.T) {
+	_, addr := startTestServer(t, &Echo{})
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var calls []string
+	client.Use(func(ctx context.Context, serviceMethod string, args, reply any, next Invoker) error {
+		ctx = AppendToOutgoingContext(ctx, "trace-id", "t-2")
+		err := next(ctx, serviceMethod, args, reply)
+		calls = append(calls, serviceMethod+":"+*reply.(*string))
+		return err
+	})
+
+	var reply string
+	err = client.Call(context.Background(), "Echo.Metadata", "trace-id", &reply)
+	_assert(err == nil && reply == "t-2", "interceptor should inject metadata, got %q, %v", reply, err)
+
+	// Go goes through the interceptors as well
+	call := <-client.Go("Echo.Metadata", "trace-id", &reply, nil).Done
+	_assert(call.Error == nil && reply == "t-2" && call.ReplyMetadata["echo"] == "t-2", "unexpected async call %+v", call)
+	_assert(strings.Join(calls, ",") == "Echo.Metadata:t-2,Echo.Metadata:t-2", "unexpected calls %v", calls)
+}
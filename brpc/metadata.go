@@ -0,0 +1,102 @@
+package brpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Metadata 随请求与响应一起传输的键值对，用于 trace id、租户 id、鉴权 token 等信息，
+// 这些信息不需要写进每个方法的 Args 结构体
+type Metadata map[string]string
+
+// Copy returns a copy of md
+func (md Metadata) Copy() Metadata {
+	out := make(Metadata, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+type (
+	outgoingMetadataKey struct{}
+	incomingMetadataKey struct{}
+	replyMetadataKey    struct{} // server side, holds *replyMetadata
+	replyReceiverKey    struct{} // client side, holds *Metadata
+)
+
+// NewOutgoingContext attaches md to ctx, Client.Call sends it to the server
+func NewOutgoingContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, outgoingMetadataKey{}, md)
+}
+
+// AppendToOutgoingContext returns a new context with the key-value pairs kv
+// merged into the outgoing metadata of ctx, kv must come in pairs
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	if len(kv)%2 == 1 {
+		panic("brpc: AppendToOutgoingContext got an odd number of input pairs")
+	}
+	md, _ := FromOutgoingContext(ctx)
+	md = md.Copy()
+	for i := 0; i < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return NewOutgoingContext(ctx, md)
+}
+
+// FromOutgoingContext returns the metadata which will be sent by Client.Call
+func FromOutgoingContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(outgoingMetadataKey{}).(Metadata)
+	return md, ok
+}
+
+// FromIncomingContext returns the metadata sent by the client,
+// ctx should be the one passed to the service method
+func FromIncomingContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(incomingMetadataKey{}).(Metadata)
+	return md, ok
+}
+
+// replyMetadata collects the metadata set by the service method, it's sent back with the response
+type replyMetadata struct {
+	mu sync.Mutex
+	md Metadata
+}
+
+func (r *replyMetadata) set(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.md == nil {
+		r.md = make(Metadata)
+	}
+	r.md[key] = value
+}
+
+func (r *replyMetadata) get() Metadata {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.md == nil {
+		return nil
+	}
+	return r.md.Copy()
+}
+
+func newIncomingContext(ctx context.Context, md Metadata, reply *replyMetadata) context.Context {
+	ctx = context.WithValue(ctx, incomingMetadataKey{}, md)
+	return context.WithValue(ctx, replyMetadataKey{}, reply)
+}
+
+// SetReplyMetadata sets a key-value pair which is sent back to the client along with the response,
+// ctx should be the one passed to the service method. It returns false if ctx is not such one.
+func SetReplyMetadata(ctx context.Context, key, value string) bool {
+	reply, ok := ctx.Value(replyMetadataKey{}).(*replyMetadata)
+	if ok {
+		reply.set(key, value)
+	}
+	return ok
+}
+
+// WithReplyMetadata asks Client.Call to store the metadata replied by the server into md
+func WithReplyMetadata(ctx context.Context, md *Metadata) context.Context {
+	return context.WithValue(ctx, replyReceiverKey{}, md)
+}
@@ -0,0 +1,28 @@
+package brpc
+
+import "context"
+
+// Caller makes a single call, both Client and xclient.XClient implement it
+type Caller interface {
+	Call(ctx context.Context, serviceMethod string, args, reply any) error
+}
+
+var _ Caller = (*Client)(nil)
+
+// Method is a typed function calling a remote method, see NewMethod
+type Method[A, R any] func(ctx context.Context, args A) (R, error)
+
+// NewMethod returns a typed function calling serviceMethod through c, so that mismatched
+// args or reply show up at compile time rather than at runtime. For example:
+//
+//	sum := brpc.NewMethod[Args, int](client, "Foo.Sum")
+//	reply, err := sum(ctx, Args{Num1: 1, Num2: 2})
+//
+// cmd/brpcgen generates such wrappers for all methods of a service.
+func NewMethod[A, R any](c Caller, serviceMethod string) Method[A, R] {
+	return func(ctx context.Context, args A) (R, error) {
+		var reply R
+		err := c.Call(ctx, serviceMethod, args, &reply)
+		return reply, err
+	}
+}
@@ -0,0 +1,25 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewMethod(t *testing.T) {
+	_, addr := startTestServer(t, new(Foo))
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sum := NewMethod[Args, int](client, "Foo.Sum")
+	reply, err := sum(ctx, Args{Num1: 1, Num2: 2})
+	_assert(err == nil && reply == 3, "failed to call Foo.Sum: %v", err)
+
+	unknown := NewMethod[Args, int](client, "Foo.Unknown")
+	_, err = unknown(ctx, Args{})
+	_assert(errors.Is(err, NotFound), "expect NotFound, got %v", err)
+}
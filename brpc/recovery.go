@@ -0,0 +1,40 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// ErrInternal marks that the server failed unexpectedly while handling the request, such as a panic
+var ErrInternal = errors.New("rpc server: internal error")
+
+// safeInvoke recovers the panic of invoke and turns it into ErrInternal,
+// so that a bad request can't crash the whole server process
+func safeInvoke(invoke Invoker, ctx context.Context, serviceMethod string, args, reply any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			message := fmt.Sprintf("rpc server: panic in %s: %v", serviceMethod, r)
+			log.Printf("%s\n\n", trace(message))
+			err = fmt.Errorf("%w: panic in %s", ErrInternal, serviceMethod)
+		}
+	}()
+	return invoke(ctx, serviceMethod, args, reply)
+}
+
+func trace(msg string) string {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:]) // skip first 3 caller
+
+	var str strings.Builder
+	str.WriteString(msg + "\nTraceback:")
+	for _, pc := range pcs[:n] {
+		fn := runtime.FuncForPC(pc)
+		file, line := fn.FileLine(pc)
+		str.WriteString(fmt.Sprintf("\n\t%s:%d", file, line))
+	}
+	return str.String()
+}
@@ -0,0 +1,193 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry is a simple register center, provide following functions.
+// add a server and receive heartbeat to keep it alive.
+// returns all alive servers and delete dead servers sync simultaneously.
+//
+// 协议基于 HTTP，服务地址通过请求头传递：
+//
+//	GET    返回所有存活的服务，以逗号分隔放在 X-Brpc-Servers 中
+//	POST   注册服务或发送心跳，服务地址放在 X-Brpc-Server 中
+//	DELETE 注销服务，服务地址放在 X-Brpc-Server 中
+type Registry struct {
+	timeout time.Duration
+	mu      sync.Mutex // protect following
+	servers map[string]*ServerItem
+}
+
+type ServerItem struct {
+	Addr  string
+	start time.Time // time of the last heartbeat
+}
+
+const (
+	DefaultPath    = "/_brpc_/registry"
+	defaultTimeout = time.Minute * 5
+
+	serversHeader = "X-Brpc-Servers"
+	serverHeader  = "X-Brpc-Server"
+)
+
+// New create a registry instance with timeout setting,
+// a server is removed if no heartbeat is received within timeout, 0 means never
+func New(timeout time.Duration) *Registry {
+	return &Registry{
+		servers: make(map[string]*ServerItem),
+		timeout: timeout,
+	}
+}
+
+var DefaultRegister = New(defaultTimeout)
+
+func (r *Registry) putServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.servers[addr]
+	if s == nil {
+		r.servers[addr] = &ServerItem{Addr: addr, start: time.Now()}
+	} else {
+		s.start = time.Now() // if exists, update start time to keep alive
+	}
+}
+
+func (r *Registry) removeServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.servers, addr)
+}
+
+// aliveServers returns the alive servers sorted by address, and deletes the dead ones
+func (r *Registry) aliveServers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var alive []string
+	for addr, s := range r.servers {
+		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
+			alive = append(alive, addr)
+		} else {
+			delete(r.servers, addr)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+// Runs at /_brpc_/registry
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		// keep it simple, server is in req.Header
+		w.Header().Set(serversHeader, strings.Join(r.aliveServers(), ","))
+	case http.MethodPost, http.MethodDelete:
+		addr := req.Header.Get(serverHeader)
+		if addr == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Method == http.MethodPost {
+			r.putServer(addr)
+		} else {
+			r.removeServer(addr)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleHTTP registers an HTTP handler for Registry messages on registryPath
+func (r *Registry) HandleHTTP(registryPath string) {
+	http.Handle(registryPath, r)
+	log.Println("rpc registry path:", registryPath)
+}
+
+func HandleHTTP() {
+	DefaultRegister.HandleHTTP(DefaultPath)
+}
+
+// Heartbeat registers addr to the registry, then sends a heartbeat every duration
+// until ctx is done, at which time addr is removed from the registry.
+// The registry is the url of the registry, such as http://localhost:9999/_brpc_/registry.
+// If duration is 0, a default one is used which leaves enough time before the default timeout.
+// The error of the first registration is returned, later failures are only logged.
+func Heartbeat(ctx context.Context, registry, addr string, duration time.Duration) error {
+	if duration == 0 {
+		// make sure there is enough time to send heart beat
+		// before it's removed from registry
+		duration = defaultTimeout - time.Duration(1)*time.Minute
+	}
+	if err := sendHeartbeat(ctx, http.MethodPost, registry, addr); err != nil {
+		return err
+	}
+	go func() {
+		t := time.NewTicker(duration)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := sendHeartbeat(ctx, http.MethodPost, registry, addr); err != nil {
+					log.Println("rpc server: heart beat err:", err)
+				}
+			case <-ctx.Done():
+				// ctx is done already, give the removal a moment of its own
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				if err := sendHeartbeat(ctx, http.MethodDelete, registry, addr); err != nil {
+					log.Println("rpc server: unregister err:", err)
+				}
+				cancel()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func sendHeartbeat(ctx context.Context, method, registry, addr string) error {
+	req, err := http.NewRequestWithContext(ctx, method, registry, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(serverHeader, addr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("rpc registry: unexpected status " + resp.Status)
+	}
+	return nil
+}
+
+// Servers asks the registry at url for the alive servers
+func Servers(ctx context.Context, url string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("rpc registry: unexpected status " + resp.Status)
+	}
+	var servers []string
+	for _, addr := range strings.Split(resp.Header.Get(serversHeader), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			servers = append(servers, addr)
+		}
+	}
+	return servers, nil
+}
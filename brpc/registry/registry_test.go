@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Heartbeat(t *testing.T) {
+	r := New(200 * time.Millisecond)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	ctx := context.Background()
+
+	ctx1, stop1 := context.WithCancel(ctx)
+	defer stop1()
+	assert.NoError(t, Heartbeat(ctx1, ts.URL, "tcp@127.0.0.1:1", 50*time.Millisecond))
+	ctx2, stop2 := context.WithCancel(ctx)
+	defer stop2()
+	// heartbeats of the second server are too slow to keep it alive
+	assert.NoError(t, Heartbeat(ctx2, ts.URL, "tcp@127.0.0.1:2", time.Hour))
+
+	servers, err := Servers(ctx, ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"}, servers)
+
+	time.Sleep(300 * time.Millisecond)
+	servers, err = Servers(ctx, ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tcp@127.0.0.1:1"}, servers)
+
+	// the server is removed from the registry once its heartbeat stops
+	stop1()
+	assert.Eventually(t, func() bool {
+		servers, err = Servers(ctx, ts.URL)
+		return err == nil && len(servers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := New(0)
+	for _, c := range []struct {
+		method, addr string
+		status       int
+	}{
+		{http.MethodPost, "", http.StatusBadRequest},
+		{http.MethodPut, "tcp@127.0.0.1:1", http.StatusMethodNotAllowed},
+		{http.MethodPost, "tcp@127.0.0.1:1", http.StatusOK},
+	} {
+		req := httptest.NewRequest(c.method, DefaultPath, nil)
+		req.Header.Set(serverHeader, c.addr)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, c.status, rec.Code, "%s %q", c.method, c.addr)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+	assert.Equal(t, "tcp@127.0.0.1:1", rec.Header().Get(serversHeader))
+
+	assert.Error(t, Heartbeat(context.Background(), "http://127.0.0.1:1/registry", "tcp@127.0.0.1:1", 0))
+}
@@ -1,33 +1,39 @@
 package brpc
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/gob"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/bswaterb/goX/brpc/codec"
 	"io"
 	"log"
 	"net"
-	"reflect"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	MagicNumber = 0x123abc
+	MagicNumber     = 0x123abc
+	ProtocolVersion = 1
+)
+
+const (
+	connected      = "200 Connected to brpc"
+	DefaultRPCPath = "/_brpc_"
 )
 
 // Option
 // this filed is the start in conn msg
-// [<- Option ->][<- Header ->][<- Body ->][<- Header ->][<- Body ->]......
-// part of [<- Option ->] is codec by json
+// [<- Option ->][<- Frame ->][<- Frame ->]......
+// part of [<- Option ->] is codec by json and ends with '\n',
+// server replies a handshakeReply in the same format before any frame is sent
+// every [<- Frame ->] is [<- Prefix ->][<- Header ->][<- Body ->], see codec.WriteFrame
 // part of [<- Header ->] and [<- Body ->] is codec by Option.CodecType
 type Option struct {
 	MagicNumber int
+	Version     int
 	CodecType   codec.Type
 
 	ConnectTimeout time.Duration // 0 means no limit
@@ -36,6 +42,7 @@ type Option struct {
 
 var DefaultOption = &Option{
 	MagicNumber:    MagicNumber,
+	Version:        ProtocolVersion,
 	CodecType:      codec.TypeGob,
 	ConnectTimeout: time.Second * 10,
 }
@@ -44,52 +51,99 @@ var DefaultServer = NewServer()
 
 // Server represents an RPC Server.
 type Server struct {
-	serviceMap sync.Map
-	readLock   sync.Mutex
+	serviceMap   sync.Map
+	readLock     sync.Mutex
+	registerMu   sync.Mutex // serialize the registration of services
+	interceptors []Interceptor
+
+	mu         sync.Mutex // protect following
+	inShutdown bool
+	listeners  map[net.Listener]struct{}
+	conns      map[*serverConn]struct{}
 }
 
 func NewServer() *Server {
-	return &Server{}
+	server := &Server{
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+	}
+	server.serviceMap.Store(ReservedService, newReservedService(server))
+	return server
 }
 
-// Register publishes in the server the set of methods of the
+// ErrServerShutdown is replied to the requests arriving after Shutdown is called
+// and rejected before they're handled, so they're safe to retry on another server
+var ErrServerShutdown error = &Error{Code: Unavailable, Message: "rpc server: server is shutting down"}
+
+// Register publishes in the server the set of methods of the receiver value regObj.
+// The funcs already published in the service by RegisterFunc are kept. If one of them has
+// the same name as a method of the receiver, an error is returned and nothing is published.
 func (server *Server) Register(regObj any) error {
 	s := newService(regObj)
-	if _, dup := server.serviceMap.LoadOrStore(s.name, s); dup {
-		return errors.New("rpc: service already defined: " + s.name)
+	server.registerMu.Lock()
+	defer server.registerMu.Unlock()
+	if svci, ok := server.serviceMap.Load(s.name); ok {
+		old := svci.(*service)
+		if old.objType != nil {
+			return errors.New("rpc: service already defined: " + s.name)
+		}
+		for name, mtype := range old.method {
+			if _, dup := s.method[name]; dup {
+				return errors.New("rpc: method already defined: " + s.name + "." + name)
+			}
+			s.method[name] = mtype
+		}
 	}
+	// services are read without lock while serving, so store the merged copy as a whole
+	server.serviceMap.Store(s.name, s)
 	return nil
 }
 
 // Register publishes the receiver's methods in the DefaultServer.
 func Register(regObj any) error { return DefaultServer.Register(regObj) }
 
+// Use adds interceptors around every RPC handled by the server,
+// they run in the order they are added. It should be called before serving.
+func (server *Server) Use(interceptors ...Interceptor) {
+	server.interceptors = append(server.interceptors, interceptors...)
+}
+
+// Use adds interceptors to the DefaultServer.
+func Use(interceptors ...Interceptor) { DefaultServer.Use(interceptors...) }
+
 func (server *Server) findService(serviceMethod string) (svc *service, mtype *methodType, err error) {
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		err = Errorf(InvalidArgument, "rpc server: service/method request ill-formed: %s", serviceMethod)
 		return
 	}
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	svci, ok := server.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc server: can't find service " + serviceName)
+		err = Errorf(NotFound, "rpc server: can't find service %s", serviceName)
 		return
 	}
 	svc = svci.(*service)
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc server: can't find method " + methodName)
+		err = Errorf(NotFound, "rpc server: can't find method %s", methodName)
 	}
 	return
 }
 
 // Accept accepts connections on the listener and serves requests
 func (server *Server) Accept(listener net.Listener) {
+	if !server.trackListener(listener, true) {
+		_ = listener.Close()
+		return
+	}
+	defer server.trackListener(listener, false)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Println("rpc server: accept error:", err)
+			if !server.shuttingDown() {
+				log.Println("rpc server: accept error:", err)
+			}
 			return
 		}
 		go server.ServeConn(conn)
@@ -98,6 +152,37 @@ func (server *Server) Accept(listener net.Listener) {
 
 func Accept(listener net.Listener) { DefaultServer.Accept(listener) }
 
+// ServeHTTP implements an http.Handler that answers RPC requests,
+// the CONNECT request is hijacked and the conn is then served by ServeConn
+func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		log.Print("rpc hijacking ", req.RemoteAddr, ": ", err.Error())
+		return
+	}
+	_, _ = io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
+	server.ServeConn(conn)
+}
+
+// HandleHTTP registers an HTTP handler for RPC messages on DefaultRPCPath,
+// and a debugging handler on DefaultDebugPath.
+// It is still necessary to invoke http.Serve(), typically in a go statement.
+// To share a port with other handlers such as bttp.Engine, mount server on DefaultRPCPath of your own mux instead.
+func (server *Server) HandleHTTP() {
+	http.Handle(DefaultRPCPath, server)
+	http.Handle(DefaultDebugPath, server.DebugHandler())
+	log.Println("rpc server debug path:", DefaultDebugPath)
+}
+
+// HandleHTTP is a convenient approach for default server to register HTTP handlers
+func HandleHTTP() { DefaultServer.HandleHTTP() }
+
 // ServeConn  handle the incoming conn
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer func() {
@@ -105,51 +190,152 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	}()
 
 	var opt Option
-
-	//if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-	//	fmt.Println("brpc server: options error: ", err)
-	//	return
-	//}
-	// err := receiveMessageWithDelimiter(conn.(net.Conn), &opt)
-	err := gob.NewDecoder(conn).Decode(&opt)
-	if err != nil {
+	if err := receiveMessageWithDelimiter(conn, &opt); err != nil {
 		log.Printf("rpc server: failed to receive json option message %s", err)
 		return
 	}
-	if opt.MagicNumber != MagicNumber {
-		log.Printf("brpc server: invalid magic number %x", opt.MagicNumber)
+	f, err := checkOption(&opt)
+	if err == nil && server.shuttingDown() {
+		err = ErrServerShutdown
+	}
+	if err != nil {
+		log.Println("brpc server: handshake rejected:", err)
+		_ = sendMessageWithDelimiter(conn, &handshakeReply{Err: err.Error()})
 		return
 	}
-	codecFuncMap := codec.GetCodecFuncMap()
-	f := codecFuncMap[opt.CodecType]
-	if f == nil {
-		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
+	if err = sendMessageWithDelimiter(conn, &handshakeReply{Accept: true}); err != nil {
+		log.Println("rpc server: failed to reply handshake:", err)
 		return
 	}
 	log.Printf("brpc server: 新连接 %#v 建立成功，编码类型: %s\n", conn, opt.CodecType)
 	server.serveCodec(f(conn), &opt)
 }
 
-func receiveMessageWithDelimiter(conn net.Conn, data interface{}) error {
-	reader := bufio.NewReader(conn)
+// checkOption validates the handshake and returns the negotiated codec
+func checkOption(opt *Option) (codec.NewCodecFunc, error) {
+	if opt.MagicNumber != MagicNumber {
+		return nil, fmt.Errorf("invalid magic number %x", opt.MagicNumber)
+	}
+	if opt.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d, expect %d", opt.Version, ProtocolVersion)
+	}
+	f := codec.GetCodecFunc(opt.CodecType)
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
+	}
+	return f, nil
+}
 
-	jsonData, err := reader.ReadBytes('\n')
-	if err != nil {
-		return err
+var invalidRequest = struct{}{}
+
+// serverConn holds the state of one connection served by serveCodec
+type serverConn struct {
+	cc       codec.Codec
+	opt      *Option
+	sending  sync.Mutex     // make sure to send a complete response
+	wg       sync.WaitGroup // wait until all request are handled
+	mu       sync.Mutex     // protect following
+	cancels  map[uint64]context.CancelFunc
+	streams  map[uint64]*ServerStream
+	draining bool // the server is shutting down, no more request is accepted
+}
+
+// track records the cancel func of a running request, so that the client can cancel it by Seq,
+// st is the stream of a streaming request and nil otherwise.
+// It returns false once the connection is draining.
+func (sc *serverConn) track(seq uint64, cancel context.CancelFunc, st *ServerStream) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.draining {
+		return false
 	}
+	sc.cancels[seq] = cancel
+	if st != nil {
+		sc.streams[seq] = st
+	}
+	return true
+}
 
-	jsonData = bytes.TrimRight(jsonData, "\n")
-	if err := json.Unmarshal(jsonData, data); err != nil {
-		return err
+// untrack removes seq and releases its context
+func (sc *serverConn) untrack(seq uint64) {
+	sc.mu.Lock()
+	cancel := sc.cancels[seq]
+	delete(sc.cancels, seq)
+	delete(sc.streams, seq)
+	sc.mu.Unlock()
+	if cancel != nil {
+		cancel()
 	}
-	return nil
 }
 
-var invalidRequest = struct{}{}
+// cancel cancels the running request with seq, the request may have already finished
+func (sc *serverConn) cancel(seq uint64) {
+	sc.mu.Lock()
+	cancel := sc.cancels[seq]
+	sc.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// stream returns the stream of the running request with seq, or nil
+func (sc *serverConn) stream(seq uint64) *ServerStream {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.streams[seq]
+}
+
+// handleStream delivers a message, the end of messages or a window update to the stream with seq.
+// Those of a finished request are dropped.
+func (sc *serverConn) handleStream(h *codec.Header, raw *codec.RawBody) {
+	st := sc.stream(h.Seq)
+	if st == nil {
+		return
+	}
+	switch h.Kind {
+	case codec.KindStreamMsg:
+		if !st.push(raw) {
+			log.Println("rpc server:", errFlowControl)
+			sc.cancel(h.Seq)
+		}
+	case codec.KindStreamEnd:
+		st.closeRecv()
+	case codec.KindWindowUpdate:
+		st.sendWindow.release(int(h.Window))
+	}
+}
+
+// goAway tells the client to stop sending new calls, running requests are still handled
+func (sc *serverConn) goAway() {
+	sc.mu.Lock()
+	sc.draining = true
+	sc.mu.Unlock()
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	_ = sc.cc.Write(&codec.Header{Kind: codec.KindGoAway}, nil)
+}
+
+// numInflight returns how many requests are being handled
+func (sc *serverConn) numInflight() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return len(sc.cancels)
+}
 
 func (server *Server) serveCodec(cc codec.Codec, opt *Option) {
-	var sending sync.Mutex // make sure to send a complete response
-	var wg sync.WaitGroup  // wait until all request are handled
+	sc := &serverConn{
+		cc:      cc,
+		opt:     opt,
+		cancels: make(map[uint64]context.CancelFunc),
+		streams: make(map[uint64]*ServerStream),
+	}
+	if !server.trackConn(sc, true) {
+		_ = cc.Close()
+		return
+	}
+	defer server.trackConn(sc, false)
+	// ctx is cancelled once the client goes away, so that handlers can stop early
+	ctx, cancel := context.WithCancel(context.Background())
 
 	for {
 		req, err := server.readRequest(cc)
@@ -157,23 +343,138 @@ func (server *Server) serveCodec(cc codec.Codec, opt *Option) {
 			if req == nil {
 				break // it's not possible to recover, so close the connection
 			}
-			req.h.Err = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, &sending)
+			if req.h.Kind != codec.KindCall {
+				// only calls are replied, an error reply here would be taken as
+				// a message of the stream, and the call still sends its own response
+				log.Printf("rpc server: drop bad message of kind %d, seq %d: %v\n", req.h.Kind, req.h.Seq, err)
+				continue
+			}
+			setError(req.h, err)
+			server.sendResponse(sc, req.h, invalidRequest)
 			continue
 		}
-		wg.Add(1)
-		go server.handleRequest(cc, req, &sending, &wg, opt.HandleTimeout)
+		switch req.h.Kind {
+		case codec.KindCancel:
+			sc.cancel(req.h.Seq)
+			continue
+		case codec.KindStreamMsg, codec.KindStreamEnd, codec.KindWindowUpdate:
+			sc.handleStream(req.h, req.raw)
+			continue
+		}
+		if req.mtype.StreamKind != Unary {
+			req.stream = newServerStream(sc, req.h.Seq)
+		}
+		// track before handling, the cancel message or stream messages may follow right after the request
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		if !sc.track(req.h.Seq, reqCancel, req.stream) {
+			reqCancel()
+			setError(req.h, ErrServerShutdown)
+			server.sendResponse(sc, req.h, invalidRequest)
+			continue
+		}
+		sc.wg.Add(1)
+		go server.handleRequest(reqCtx, sc, req)
 	}
-	wg.Wait()
+	cancel()
+	sc.wg.Wait()
 	_ = cc.Close()
 }
 
+func (server *Server) shuttingDown() bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.inShutdown
+}
+
+// trackListener adds or removes l, it returns false if l can't be added since the server is shutting down
+func (server *Server) trackListener(l net.Listener, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !add {
+		delete(server.listeners, l)
+		return true
+	}
+	if server.inShutdown {
+		return false
+	}
+	server.listeners[l] = struct{}{}
+	return true
+}
+
+// trackConn adds or removes sc, it returns false if sc can't be added since the server is shutting down
+func (server *Server) trackConn(sc *serverConn, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !add {
+		delete(server.conns, sc)
+		return true
+	}
+	if server.inShutdown {
+		return false
+	}
+	server.conns[sc] = struct{}{}
+	return true
+}
+
+// shutdownPollInterval is how often Shutdown checks whether the running requests are all done
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully shuts down the server: it closes all listeners, tells the clients
+// to stop sending new calls, waits for running requests to finish, then closes the connections.
+// If ctx is done before the running requests finish, the connections are closed anyway
+// and ctx.Err() is returned.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.mu.Lock()
+	server.inShutdown = true
+	for l := range server.listeners {
+		_ = l.Close()
+	}
+	conns := make([]*serverConn, 0, len(server.conns))
+	for sc := range server.conns {
+		conns = append(conns, sc)
+	}
+	server.mu.Unlock()
+
+	for _, sc := range conns {
+		sc.goAway()
+	}
+	closeConns := func() {
+		for _, sc := range conns {
+			_ = sc.cc.Close()
+		}
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		inflight := 0
+		for _, sc := range conns {
+			inflight += sc.numInflight()
+		}
+		if inflight == 0 {
+			closeConns()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown gracefully shuts down the DefaultServer.
+func Shutdown(ctx context.Context) error { return DefaultServer.Shutdown(ctx) }
+
 // request stores all information of a call
 type request struct {
 	h           *codec.Header // header of request
-	argV, respV reflect.Value // argV and respV of request
+	argp, reply any           // pointer to the decoded args and the reply, reply is nil if the method has none
 	mtype       *methodType
 	svc         *service
+	stream      *ServerStream  // not nil for streaming methods
+	raw         *codec.RawBody // body of a stream message
 }
 
 func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
@@ -195,67 +496,125 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 		return nil, err
 	}
 	req := &request{h: h}
+	switch h.Kind {
+	case codec.KindCancel, codec.KindStreamEnd, codec.KindWindowUpdate:
+		// these messages carry nothing but the header
+		return req, cc.ReadBody(nil)
+	case codec.KindStreamMsg:
+		// the type of the message is known by Recv only
+		req.raw = new(codec.RawBody)
+		return req, cc.ReadBody(req.raw)
+	}
 	req.svc, req.mtype, err = server.findService(h.ServiceMethod)
 	if err != nil {
+		// the body still has to be consumed, or it would be taken as the next header
+		_ = cc.ReadBody(nil)
 		return req, err
 	}
-	req.argV = req.mtype.newArgV()
-	req.respV = req.mtype.newRespV()
-
-	// make sure that argvi is a pointer, ReadBody need a pointer as parameter
-	argvi := req.argV.Interface()
-	if req.argV.Type().Kind() != reflect.Ptr {
-		argvi = req.argV.Addr().Interface()
+	if req.mtype.RespType != nil {
+		req.reply = req.mtype.newReply()
+	}
+	if req.mtype.ArgType == nil {
+		// messages of client-streaming and bidi-streaming methods come later with the stream
+		_ = cc.ReadBody(nil)
+		return req, nil
 	}
-	if err = cc.ReadBody(argvi); err != nil {
+	// ReadBody need a pointer as parameter
+	req.argp = req.mtype.newArg()
+	if err = cc.ReadBody(req.argp); err != nil {
 		log.Println("rpc server: read body err:", err)
-		return req, err
+		return req, &Error{Code: InvalidArgument, Message: err.Error()}
 	}
 	return req, nil
 }
 
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
-	sending.Lock()
-	defer sending.Unlock()
-	if err := cc.Write(h, body); err != nil {
+func (server *Server) sendResponse(sc *serverConn, h *codec.Header, body interface{}) {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	if err := sc.cc.Write(h, body); err != nil {
 		fmt.Println("rpc server: write response error:", err)
 	}
 }
 
-func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
-	defer wg.Done()
-	called := make(chan struct{})
-	sent := make(chan struct{})
+// handleTimeout returns the time limit of req, the smaller one of
+// Option.HandleTimeout and the remaining deadline sent by the client
+func handleTimeout(opt *Option, h *codec.Header) time.Duration {
+	timeout := opt.HandleTimeout
+	if h.Timeout > 0 && (timeout == 0 || h.Timeout < timeout) {
+		timeout = h.Timeout
+	}
+	return timeout
+}
+
+// handleRequest runs the request and sends exactly one response for its Seq.
+// The service method runs in its own goroutine and reports to a buffered channel,
+// so it never blocks even if handleRequest has given up on it, and only handleRequest
+// writes the response, a late method can't send a second one.
+func (server *Server) handleRequest(ctx context.Context, sc *serverConn, req *request) {
+	defer sc.wg.Done()
+	// the handler sees ctx done once handleRequest gives up on it or the client cancels it
+	defer sc.untrack(req.h.Seq)
+	timeout := handleTimeout(sc.opt, req.h)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	reply := &replyMetadata{}
+	ctx = newIncomingContext(ctx, req.h.Metadata, reply)
+
+	invoke := ChainInterceptors(server.interceptors, func(ctx context.Context, _ string, args, reply any) error {
+		return req.svc.invoke(ctx, req.mtype, args, reply)
+	})
+	var argv, respv any
+	switch req.mtype.StreamKind {
+	case Unary:
+		argv, respv = req.mtype.argOf(req.argp), req.reply
+	case ServerStreaming:
+		argv, respv = req.mtype.argOf(req.argp), req.stream
+	case ClientStreaming:
+		argv, respv = req.stream, req.reply
+	case BidiStreaming:
+		argv = req.stream
+	}
+	if req.stream != nil {
+		req.stream.ctx = ctx
+	}
+	called := make(chan error, 1)
 	go func() {
-		err := req.svc.call(req.mtype, req.argV, req.respV)
-		called <- struct{}{}
-		if err != nil {
-			req.h.Err = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
-			return
-		}
-		server.sendResponse(cc, req.h, req.respV.Interface(), sending)
-		sent <- struct{}{}
+		called <- safeInvoke(invoke, ctx, req.h.ServiceMethod, argv, respv)
 	}()
 
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
-	}
-	ddl := time.After(timeout)
-timeoutCheck:
+	var err error
 	select {
-	case <-ddl:
-		req.h.Err = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
-		server.sendResponse(cc, req.h, invalidRequest, sending)
-	case <-called:
+	case err = <-called:
+	case <-ctx.Done():
 		select {
-		case <-ddl:
-			req.h.Err = fmt.Sprintf("rpc server: called successfully but sent timeout: expect within %s", timeout)
-		case <-sent:
-			break timeoutCheck
+		case err = <-called: // finished at the same moment, a successful result is still valid
+		default:
+			err = ctx.Err()
 		}
 	}
+	// the method most likely failed because ctx is done, tell the client why
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = Errorf(DeadlineExceeded, "rpc server: request handle timeout: expect within %s", timeout)
+		} else {
+			err = Errorf(Canceled, "rpc server: request canceled: %s", ctx.Err())
+		}
+	}
+
+	// the final response ends the stream, nothing is sent by the method after it
+	if req.stream != nil {
+		req.stream.finish()
+	}
+	// the response header is a new one, the method may still be running with req
+	h := &codec.Header{ServiceMethod: req.h.ServiceMethod, Seq: req.h.Seq, Metadata: reply.get()}
+	if err != nil {
+		setError(h, err)
+		server.sendResponse(sc, h, invalidRequest)
+		return
+	}
+	// only unary and client-streaming methods have a reply
+	server.sendResponse(sc, h, req.reply)
 }
@@ -0,0 +1,414 @@
+package brpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bswaterb/goX/brpc/codec"
+	"github.com/bswaterb/goX/bttp"
+)
+
+// startTestServer registers rcvrs in a new server and serves it on a random port until the test ends
+func startTestServer(t *testing.T, rcvrs ...any) (*Server, string) {
+	t.Helper()
+	server := NewServer()
+	for _, rcvr := range rcvrs {
+		_assert(server.Register(rcvr) == nil, "failed to register %T", rcvr)
+	}
+	return server, serveTestServer(t, server)
+}
+
+// serveTestServer serves server on a random port until the test ends, for the servers
+// which need more than Register before serving, such as RegisterFunc and Use
+func serveTestServer(t *testing.T, server *Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen: %v", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return l.Addr().String()
+}
+
+func TestServer_CodecNegotiation(t *testing.T) {
+	_, addr := startTestServer(t, new(Foo))
+	for _, typ := range []codec.Type{codec.TypeGob, codec.TypeJson} {
+		client, err := Dial("tcp", addr, &Option{CodecType: typ})
+		_assert(err == nil, "%s: dial error: %v", typ, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		var reply int
+		err = client.Call(ctx, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "%s: failed to call Foo.Sum: %v", typ, err)
+
+		// an unknown method must not break the stream for the following calls
+		err = client.Call(ctx, "Foo.Unknown", &Args{}, &reply)
+		_assert(err != nil && strings.Contains(err.Error(), "can't find method"), "%s: expect method error, got %v", typ, err)
+		err = client.Call(ctx, "Foo.Sum", &Args{Num1: 3, Num2: 4}, &reply)
+		_assert(err == nil && reply == 7, "%s: failed to call Foo.Sum after error: %v", typ, err)
+
+		cancel()
+		_ = client.Close()
+	}
+}
+
+func TestServer_RegisteredCodec(t *testing.T) {
+	const typ codec.Type = "application/x-brpc-test"
+	if codec.GetCodecFunc(typ) == nil { // the test may run more than once
+		_assert(codec.Register(typ, codec.NewJsonCodec) == nil, "failed to register codec %s", typ)
+	}
+	_assert(codec.Register(typ, codec.NewGobCodec) != nil, "duplicate codec %s should be refused", typ)
+	_assert(codec.Register(codec.TypeGob, codec.NewGobCodec) != nil, "builtin codec should not be overwritten")
+
+	_, addr := startTestServer(t, new(Foo))
+	client, err := Dial("tcp", addr, &Option{CodecType: typ})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply int
+	err = client.Call(ctx, "Foo.Sum", &Args{Num1: 5, Num2: 6}, &reply)
+	_assert(err == nil && reply == 11, "failed to call Foo.Sum with %s: %v", typ, err)
+}
+
+func TestServer_BadBodyOnlyFailsItsRequest(t *testing.T) {
+	_, addr := startTestServer(t, new(Foo))
+	conn, err := net.Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = conn.Close() }()
+	// handshake by hand, the way a non-Go client would do
+	_, err = conn.Write([]byte(fmt.Sprintf(`{"MagicNumber":%d,"Version":%d,"CodecType":"%s"}`+"\n", MagicNumber, ProtocolVersion, codec.TypeGob)))
+	_assert(err == nil, "failed to send option: %v", err)
+	var reply handshakeReply
+	_assert(receiveMessageWithDelimiter(conn, &reply) == nil && reply.Accept, "handshake should be accepted: %+v", reply)
+
+	// a frame whose body is not valid gob, followed by a well-formed request
+	var header bytes.Buffer
+	_ = gob.NewEncoder(&header).Encode(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1})
+	_assert(codec.WriteFrame(conn, header.Bytes(), []byte("not a gob body")) == nil, "failed to write frame")
+	cc := codec.NewGobCodec(conn)
+	_assert(cc.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 2}, &Args{Num1: 1, Num2: 1}) == nil, "failed to write request")
+
+	replies := make(map[uint64]string)
+	for i := 0; i < 2; i++ {
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil, "failed to read header")
+		if h.Err != "" {
+			_ = cc.ReadBody(nil)
+			replies[h.Seq] = h.Err
+			continue
+		}
+		_assert(cc.ReadBody(&reply) == nil, "failed to read body")
+		replies[h.Seq] = fmt.Sprint(reply)
+	}
+	_assert(replies[1] != "" && replies[1] != "2", "expect seq 1 to fail, got %q", replies[1])
+	_assert(replies[2] == "2", "expect seq 2 to succeed, got %q", replies[2])
+}
+
+func TestServer_HandshakeRejected(t *testing.T) {
+	_, addr := startTestServer(t, new(Foo))
+	_, err := Dial("tcp", addr, &Option{CodecType: "application/unknown"})
+	_assert(err != nil, "dial with unknown codec should fail")
+
+	// the client refuses the unknown codec before sending anything, so the server is asked directly
+	for _, c := range []struct {
+		modify func(opt *Option)
+		want   string
+	}{
+		{func(opt *Option) { opt.CodecType = "application/unknown" }, "codec type application/unknown"},
+		{func(opt *Option) { opt.Version = ProtocolVersion + 1 }, "version"},
+		{func(opt *Option) { opt.MagicNumber++ }, "magic number"},
+	} {
+		conn, err := net.Dial("tcp", addr)
+		_assert(err == nil, "dial error: %v", err)
+		opt := *DefaultOption
+		c.modify(&opt)
+		_assert(sendMessageWithDelimiter(conn, &opt) == nil, "failed to send option")
+		var reply handshakeReply
+		err = receiveMessageWithDelimiter(conn, &reply)
+		_assert(err == nil && !reply.Accept && strings.Contains(reply.Err, c.want), "expect %q rejection, got %+v, %v", c.want, reply, err)
+		_ = conn.Close()
+	}
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	var foo Foo
+	server := NewServer()
+	_assert(server.Register(&foo) == nil, "failed to register Foo")
+
+	// brpc and bttp share one port
+	engine := bttp.NewEngine()
+	engine.GET("/ping", func(c *bttp.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	mux := http.NewServeMux()
+	mux.Handle(DefaultRPCPath, server)
+	mux.Handle("/", engine)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen: %v", err)
+	defer func() { _ = l.Close() }()
+	go func() { _ = http.Serve(l, mux) }()
+	addr := l.Addr().String()
+
+	client, err := XDial("http@"+addr, &Option{CodecType: codec.TypeJson})
+	_assert(err == nil, "dial http error: %v", err)
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply int
+	err = client.Call(ctx, "Foo.Sum", &Args{Num1: 2, Num2: 3}, &reply)
+	_assert(err == nil && reply == 5, "failed to call Foo.Sum over http: %v", err)
+
+	resp, err := http.Get("http://" + addr + "/ping")
+	_assert(err == nil && resp.StatusCode == http.StatusOK, "failed to get /ping: %v", err)
+	_ = resp.Body.Close()
+	resp, err = http.Get("http://" + addr + DefaultRPCPath)
+	_assert(err == nil && resp.StatusCode == http.StatusMethodNotAllowed, "expect 405 for GET %s: %v", DefaultRPCPath, err)
+	_ = resp.Body.Close()
+}
+
+func TestServer_DebugHandler(t *testing.T) {
+	server, addr := startTestServer(t, new(Foo))
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply int
+	for i := 0; i < 3; i++ {
+		_assert(client.Call(context.Background(), "Foo.Sum", &Args{Num1: i, Num2: i}, &reply) == nil, "failed to call Foo.Sum")
+	}
+
+	rec := httptest.NewRecorder()
+	server.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultDebugPath+"?format=json", nil))
+	var services []debugService
+	_assert(json.Unmarshal(rec.Body.Bytes(), &services) == nil, "invalid json: %s", rec.Body.String())
+	_assert(len(services) == 1 && services[0].Name == "Foo", "expect service Foo, got %+v", services)
+	m := services[0].Methods[0]
+	_assert(m.Name == "Sum" && m.ArgType == "brpc.Args" && m.ReplyType == "*int" && m.Calls == 3, "unexpected method %+v", m)
+
+	rec = httptest.NewRecorder()
+	server.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultDebugPath, nil))
+	_assert(strings.Contains(rec.Body.String(), "Sum(brpc.Args, *int) error"), "unexpected html: %s", rec.Body.String())
+}
+
+func TestServer_HandlerContext(t *testing.T) {
+	waiter := &Waiter{canceled: make(chan error, 1)}
+	_, addr := startTestServer(t, waiter)
+
+	client, err := Dial("tcp", addr, &Option{HandleTimeout: 100 * time.Millisecond})
+	_assert(err == nil, "dial error: %v", err)
+	var hasDeadline bool
+	err = client.Call(context.Background(), "Waiter.HasDeadline", Args{}, &hasDeadline)
+	_assert(err == nil && hasDeadline, "handler ctx should carry HandleTimeout: %v", err)
+
+	var reply int
+	err = client.Call(context.Background(), "Waiter.Wait", Args{}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect handle timeout, got %v", err)
+	select {
+	case err = <-waiter.canceled:
+		_assert(errors.Is(err, context.DeadlineExceeded), "expect deadline exceeded, got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx is not done after timeout")
+	}
+
+	// the handler ctx is also cancelled once the client goes away
+	client, err = Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	client.Go("Waiter.Wait", Args{}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	_ = client.Close()
+	select {
+	case err = <-waiter.canceled:
+		_assert(errors.Is(err, context.Canceled), "expect canceled, got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx is not done after client closed")
+	}
+}
+
+func TestServer_ClientDeadlineAndCancel(t *testing.T) {
+	waiter := &Waiter{canceled: make(chan error, 1)}
+	_, addr := startTestServer(t, waiter)
+
+	// no HandleTimeout on the server side, the deadline comes from the client ctx
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	var hasDeadline bool
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	err = client.Call(ctx, "Waiter.HasDeadline", Args{}, &hasDeadline)
+	cancel()
+	_assert(err == nil && hasDeadline, "handler ctx should carry the client deadline: %v", err)
+
+	var reply int
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = client.Call(ctx, "Waiter.Wait", Args{}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "canceled"), "expect canceled, got %v", err)
+	select {
+	case err = <-waiter.canceled:
+		_assert(errors.Is(err, context.Canceled), "expect canceled on the server, got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("server is not told about the cancellation")
+	}
+
+	// the connection is still usable after a cancellation
+	err = client.Call(context.Background(), "Waiter.HasDeadline", Args{}, &hasDeadline)
+	_assert(err == nil && !hasDeadline, "expect no deadline, got %v", err)
+}
+
+func TestServer_Metadata(t *testing.T) {
+	_, addr := startTestServer(t, &Echo{})
+
+	for _, typ := range []codec.Type{codec.TypeGob, codec.TypeJson} {
+		client, err := Dial("tcp", addr, &Option{CodecType: typ})
+		_assert(err == nil, "dial error: %v", err)
+
+		ctx := NewOutgoingContext(context.Background(), Metadata{"trace-id": "t-1"})
+		ctx = AppendToOutgoingContext(ctx, "tenant-id", "42")
+		var replyMD Metadata
+		ctx = WithReplyMetadata(ctx, &replyMD)
+		var reply string
+		err = client.Call(ctx, "Echo.Metadata", "tenant-id", &reply)
+		_assert(err == nil && reply == "42", "%s: expect tenant-id 42, got %q, %v", typ, reply, err)
+		_assert(replyMD["echo"] == "42", "%s: expect reply metadata, got %v", typ, replyMD)
+
+		err = client.Call(ctx, "Echo.Metadata", "trace-id", &reply)
+		_assert(err == nil && reply == "t-1", "%s: expect trace-id t-1, got %q, %v", typ, reply, err)
+		_ = client.Close()
+	}
+}
+
+func TestServer_RecoverPanic(t *testing.T) {
+	_, addr := startTestServer(t, &Echo{})
+	client, err := Dial("tcp", addr, &Option{HandleTimeout: time.Second})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call(context.Background(), "Echo.Panic", Args{Num1: 1}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), ErrInternal.Error()), "expect internal error, got %v", err)
+
+	// the server and the connection survive the panic
+	var md string
+	err = client.Call(AppendToOutgoingContext(context.Background(), "k", "v"), "Echo.Metadata", "k", &md)
+	_assert(err == nil && md == "v", "failed to call after panic: %v", err)
+}
+
+func TestServer_TimeoutUnderLoad(t *testing.T) {
+	const n = 500
+	_, addr := startTestServer(t, Sleeper{})
+	// the goroutines of the server itself are already running
+	before := runtime.NumGoroutine()
+
+	conn, err := net.Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	opt := *DefaultOption
+	opt.HandleTimeout = 10 * time.Millisecond
+	_assert(sendMessageWithDelimiter(conn, &opt) == nil, "failed to send option")
+	var hs handshakeReply
+	_assert(receiveMessageWithDelimiter(conn, &hs) == nil && hs.Accept, "handshake failed: %+v", hs)
+
+	// about half of the requests time out, the rest finish in time
+	cc := codec.NewGobCodec(conn)
+	go func() {
+		for seq := uint64(1); seq <= n; seq++ {
+			_ = cc.Write(&codec.Header{ServiceMethod: "Sleeper.Sleep", Seq: seq}, &Args{Num1: int(seq % 20)})
+		}
+	}()
+
+	responses := make(map[uint64]int)
+	timeouts := 0
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(responses) < n {
+		var h codec.Header
+		var reply int
+		_assert(cc.ReadHeader(&h) == nil, "failed to read header after %d responses", len(responses))
+		_ = cc.ReadBody(&reply)
+		responses[h.Seq]++
+		_assert(responses[h.Seq] == 1, "seq %d got more than one response", h.Seq)
+		if h.Err != "" {
+			_assert(strings.Contains(h.Err, "timeout"), "unexpected error %s", h.Err)
+			timeouts++
+		} else {
+			_assert(reply == int(h.Seq%20), "seq %d got reply %d", h.Seq, reply)
+		}
+	}
+	_assert(timeouts > 0 && timeouts < n, "expect some requests to time out, got %d", timeouts)
+
+	// late methods finish after their timeout, but must not write a second response
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	var h codec.Header
+	err = cc.ReadHeader(&h)
+	_assert(err != nil, "unexpected extra response for seq %d", h.Seq)
+
+	_ = conn.Close()
+	// every goroutine started for the connection exits
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_assert(runtime.NumGoroutine() <= before, "goroutines leaked: %d before, %d after", before, runtime.NumGoroutine())
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server, addr := startTestServer(t, Sleeper{})
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	running := client.Go("Sleeper.Sleep", Args{Num1: 200}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	_assert(client.NumPending() == 1, "expect 1 pending call, got %d", client.NumPending())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	err = server.Shutdown(ctx)
+	_assert(err == nil, "shutdown error: %v", err)
+	_assert(time.Since(start) >= 100*time.Millisecond, "shutdown should wait for the running request")
+
+	// the running call is finished, new calls are refused
+	call := <-running.Done
+	_assert(call.Error == nil && reply == 200, "running call should succeed: %v", call.Error)
+	_assert(client.NumPending() == 0, "expect no pending call, got %d", client.NumPending())
+	err = client.Call(context.Background(), "Sleeper.Sleep", Args{Num1: 1}, &reply)
+	_assert(errors.Is(err, ErrShutdown), "expect ErrShutdown, got %v", err)
+	_assert(errors.Is(err, ErrNotSent), "call after the goaway should not be sent, got %v", err)
+	_assert(!client.IsAvailable(), "client should not be available after shutdown")
+	_, err = Dial("tcp", addr)
+	_assert(err != nil, "listener should be closed")
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	server, addr := startTestServer(t, Sleeper{})
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	running := client.Go("Sleeper.Sleep", Args{Num1: 1000}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	_assert(errors.Is(err, context.DeadlineExceeded), "expect deadline exceeded, got %v", err)
+
+	// the connection is closed under the running call, which is reported as ErrShutdown
+	select {
+	case call := <-running.Done:
+		_assert(errors.Is(call.Error, ErrShutdown), "expect ErrShutdown, got %v", call.Error)
+	case <-time.After(time.Second):
+		t.Fatal("running call is not terminated")
+	}
+}
@@ -1,12 +1,20 @@
 package brpc
 
 import (
+	"context"
 	"go/ast"
 	"log"
 	"reflect"
 	"sync/atomic"
 )
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+	typeOfServerStream = reflect.TypeOf((*ServerStream)(nil))
+)
+
 type service struct {
 	name    string
 	objType reflect.Type
@@ -26,38 +34,87 @@ func newService(regObj any) *service {
 	return s
 }
 
+// registerMethods 注册形如 func(args, *reply) error 或 func(ctx context.Context, args, *reply) error 的方法，
+// 以及参数中带有 *ServerStream 的流式方法，见 StreamKind
 func (s *service) registerMethods() {
 	s.method = make(map[string]*methodType)
 	for i := 0; i < s.objType.NumMethod(); i++ {
 		method := s.objType.Method(i)
 		mType := method.Type
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		if mType.NumOut() != 1 || mType.Out(0) != typeOfError {
 			continue
 		}
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		// 第 0 个入参是 receiver
+		in := make([]reflect.Type, 0, mType.NumIn()-1)
+		for j := 1; j < mType.NumIn(); j++ {
+			in = append(in, mType.In(j))
+		}
+		withCtx := len(in) > 0 && in[0] == typeOfContext
+		if withCtx {
+			in = in[1:]
+		}
+		argType, respType, kind, ok := methodParams(in)
+		if !ok {
 			continue
 		}
-		argType, respType := mType.In(1), mType.In(2)
-		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(respType) {
+		if argType != nil && !isExportedOrBuiltinType(argType) || respType != nil && !isExportedOrBuiltinType(respType) {
 			continue
 		}
 		s.method[method.Name] = &methodType{
-			method:   method,
-			ArgType:  argType,
-			RespType: respType,
+			method:     method,
+			ArgType:    argType,
+			RespType:   respType,
+			StreamKind: kind,
+			withCtx:    withCtx,
 		}
 		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
 	}
 }
 
+// methodParams recognises the parameters following the optional context,
+// the position taken by *ServerStream is returned as a nil type
+func methodParams(in []reflect.Type) (argType, respType reflect.Type, kind StreamKind, ok bool) {
+	switch {
+	case len(in) == 1 && in[0] == typeOfServerStream:
+		return nil, nil, BidiStreaming, true
+	case len(in) != 2:
+		return nil, nil, Unary, false
+	case in[0] == typeOfServerStream && in[1] != typeOfServerStream:
+		return nil, in[1], ClientStreaming, true
+	case in[1] == typeOfServerStream && in[0] != typeOfServerStream:
+		return in[0], nil, ServerStreaming, true
+	case in[0] != typeOfServerStream && in[1] != typeOfServerStream:
+		return in[0], in[1], Unary, true
+	}
+	return nil, nil, Unary, false
+}
+
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-func (s *service) call(m *methodType, argv, respV reflect.Value) error {
+// invoke calls m with argv and reply, reply is nil for bidi-streaming methods
+func (s *service) invoke(ctx context.Context, m *methodType, argv, reply any) error {
+	if m.fn != nil {
+		atomic.AddUint64(&m.numCalls, 1)
+		return m.fn.call(ctx, argv, reply)
+	}
+	return s.call(ctx, m, reflect.ValueOf(argv), reflect.ValueOf(reply))
+}
+
+func (s *service) call(ctx context.Context, m *methodType, argv, respV reflect.Value) error {
 	atomic.AddUint64(&m.numCalls, 1)
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.regObj, argv, respV})
+	in := []reflect.Value{s.regObj}
+	if m.withCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	// respV is invalid for bidi-streaming methods, which take the stream only
+	in = append(in, argv)
+	if respV.IsValid() {
+		in = append(in, respV)
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
@@ -68,8 +125,14 @@ type methodType struct {
 	method   reflect.Method
 	ArgType  reflect.Type
 	RespType reflect.Type
+	// 流式方法中 *ServerStream 所在位置的 ArgType/RespType 为 nil
+	StreamKind StreamKind
+	// 方法的第一个参数是否为 context.Context
+	withCtx bool
 	// 统计该方法的累计调用次数
 	numCalls uint64
+	// fn 不为 nil 表示方法由 RegisterFunc 注册，调用时不经过反射
+	fn *funcMethod
 }
 
 func (m *methodType) NumCalls() uint64 {
@@ -101,3 +164,34 @@ func (m *methodType) newRespV() reflect.Value {
 	}
 	return respV
 }
+
+// newArg returns a pointer to a new argument, the request body is decoded into it
+func (m *methodType) newArg() any {
+	if m.fn != nil {
+		return m.fn.newArg()
+	}
+	argV := m.newArgV()
+	if argV.Kind() != reflect.Ptr {
+		return argV.Addr().Interface()
+	}
+	return argV.Interface()
+}
+
+// argOf returns the argument passed to the method from the pointer returned by newArg
+func (m *methodType) argOf(argp any) any {
+	if m.fn != nil {
+		return m.fn.argOf(argp)
+	}
+	if m.ArgType.Kind() == reflect.Ptr {
+		return argp
+	}
+	return reflect.ValueOf(argp).Elem().Interface()
+}
+
+// newReply returns a pointer to a new reply
+func (m *methodType) newReply() any {
+	if m.fn != nil {
+		return m.fn.newReply()
+	}
+	return m.newRespV().Interface()
+}
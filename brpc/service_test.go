@@ -1,9 +1,11 @@
 package brpc
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type Foo int
@@ -36,6 +38,58 @@ func (f Foo) sum(args Args, reply *int) error {
 	return nil
 }
 
+// Waiter has methods which accept a context.Context
+type Waiter struct {
+	canceled chan error
+}
+
+func (w *Waiter) Wait(ctx context.Context, args Args, reply *int) error {
+	<-ctx.Done()
+	w.canceled <- ctx.Err()
+	return ctx.Err()
+}
+
+func (w *Waiter) HasDeadline(ctx context.Context, args Args, reply *bool) error {
+	_, *reply = ctx.Deadline()
+	return nil
+}
+
+// the first parameter must be exactly context.Context
+func (w *Waiter) NotCtx(args Args, args2 Args, reply *int) error {
+	return nil
+}
+
+// Sleeper ignores ctx, so it keeps running after the request times out
+type Sleeper struct{}
+
+func (s Sleeper) Sleep(args Args, reply *int) error {
+	time.Sleep(time.Duration(args.Num1) * time.Millisecond)
+	*reply = args.Num1
+	return nil
+}
+
+type Echo struct{}
+
+// Metadata replies the value of key in the incoming metadata, and sends it back as reply metadata "echo"
+func (e Echo) Metadata(ctx context.Context, key string, reply *string) error {
+	md, _ := FromIncomingContext(ctx)
+	*reply = md[key]
+	SetReplyMetadata(ctx, "echo", md[key])
+	return nil
+}
+
+func (e Echo) Panic(args Args, reply *int) error {
+	var m map[string]int
+	m["boom"] = args.Num1
+	return nil
+}
+
+// Fail returns an *Error with code, wrapped with the method name
+func (e Echo) Fail(code Code, reply *int) error {
+	err := &Error{Code: code, Message: "fail", Details: map[string]string{"field": "num"}}
+	return fmt.Errorf("Echo.Fail: %w", err)
+}
+
 func _assert(condition bool, msg string, v ...interface{}) {
 	if !condition {
 		panic(fmt.Sprintf("assertion failed: "+msg, v...))
@@ -61,6 +115,19 @@ func TestMethodType_Call(t *testing.T) {
 	argv := mType.newArgV()
 	respV := mType.newRespV()
 	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
-	err := s.call(mType, argv, respV)
+	err := s.call(context.Background(), mType, argv, respV)
 	_assert(err == nil && *respV.Interface().(*int) == 4 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
+
+func TestNewService_WithContext(t *testing.T) {
+	s := newService(&Waiter{})
+	_assert(len(s.method) == 2, "wrong service Method, expect 2, but got %d", len(s.method))
+	mType := s.method["HasDeadline"]
+	_assert(mType != nil && mType.withCtx, "HasDeadline should be registered with ctx")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	argv, respV := mType.newArgV(), mType.newRespV()
+	err := s.call(ctx, mType, argv, respV)
+	_assert(err == nil && *respV.Interface().(*bool), "ctx should be passed to HasDeadline")
+}
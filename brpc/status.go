@@ -0,0 +1,155 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bswaterb/goX/brpc/codec"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Code 调用失败的类别，随响应一起传回客户端。
+// Code 本身实现了 error，因此可以用 errors.Is(err, brpc.NotFound) 判断错误类别
+type Code uint32
+
+const (
+	OK Code = iota
+	// Unknown 业务方法返回的普通 error，或无法归类的错误
+	Unknown
+	// InvalidArgument 请求格式错误或参数无法解码
+	InvalidArgument
+	// NotFound 服务或方法不存在
+	NotFound
+	// DeadlineExceeded 调用超时
+	DeadlineExceeded
+	// Canceled 调用被客户端取消
+	Canceled
+	// Unavailable 服务端正在关闭或连接已断开，请求未被处理时可以换一个节点重试
+	Unavailable
+	// ResourceExhausted 对端违反了流控
+	ResourceExhausted
+	// Internal 服务端内部错误，例如方法 panic
+	Internal
+)
+
+var codeNames = map[Code]string{
+	OK:                "OK",
+	Unknown:           "Unknown",
+	InvalidArgument:   "InvalidArgument",
+	NotFound:          "NotFound",
+	DeadlineExceeded:  "DeadlineExceeded",
+	Canceled:          "Canceled",
+	Unavailable:       "Unavailable",
+	ResourceExhausted: "ResourceExhausted",
+	Internal:          "Internal",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// Error makes Code usable as the target of errors.Is
+func (c Code) Error() string {
+	return "rpc: " + c.String()
+}
+
+// Error is the structured error of a call. A service method may return it
+// (or wrap it) to choose the code and details replied to the client,
+// any other error is replied with code Unknown.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]string
+}
+
+// Errorf returns an *Error with code and the formatted message
+func Errorf(code Code, format string, a ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is the Code of e, or an *Error with the same code and message,
+// so that errors.Is still works with the errors decoded from a response
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Code:
+		return e.Code == t
+	case *Error:
+		return e.Code == t.Code && e.Message == t.Message
+	}
+	return false
+}
+
+// CodeOf returns the code of err, the errors defined by this package are also recognised
+func CodeOf(err error) Code {
+	var e *Error
+	switch {
+	case err == nil:
+		return OK
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, ErrInternal):
+		return Internal
+	case errors.Is(err, ErrServerShutdown), errors.Is(err, ErrShutdown):
+		return Unavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case isConnError(err):
+		return Unavailable
+	}
+	return Unknown
+}
+
+// isConnError reports whether err comes from a broken connection
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+// statusOf converts err returned on the server side into the *Error replied to the client
+func statusOf(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Error() == err.Error() {
+			return e
+		}
+		// keep the context added by the wrappers
+		return &Error{Code: e.Code, Message: err.Error(), Details: e.Details}
+	}
+	return &Error{Code: CodeOf(err), Message: err.Error()}
+}
+
+// setError fills the error fields of the response header h
+func setError(h *codec.Header, err error) {
+	st := statusOf(err)
+	h.Err, h.Code, h.Details = st.Message, uint32(st.Code), st.Details
+}
+
+// errorOf returns the error carried by the response header h, or nil
+func errorOf(h *codec.Header) error {
+	if h.Err == "" && h.Code == uint32(OK) {
+		return nil
+	}
+	code := Code(h.Code)
+	if code == OK {
+		// replied by a server which doesn't know about codes
+		code = Unknown
+	}
+	return &Error{Code: code, Message: h.Err, Details: h.Details}
+}
+
+// callFailed is returned when ctx is done before the call completes
+func callFailed(ctx context.Context) error {
+	return &Error{Code: CodeOf(ctx.Err()), Message: "rpc client: call failed: " + ctx.Err().Error()}
+}
@@ -0,0 +1,70 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCodeOf(t *testing.T) {
+	for err, code := range map[error]Code{
+		nil:                    OK,
+		errors.New("business"): Unknown,
+		Errorf(NotFound, "x"):  NotFound,
+		fmt.Errorf("wrap: %w", Errorf(Internal, "x")): Internal,
+		fmt.Errorf("%w: panic", ErrInternal):          Internal,
+		ErrServerShutdown:                             Unavailable,
+		ErrShutdown:                                   Unavailable,
+		context.DeadlineExceeded:                      DeadlineExceeded,
+		context.Canceled:                              Canceled,
+		io.EOF:                                        Unavailable,
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")}: Unavailable,
+	} {
+		_assert(CodeOf(err) == code, "CodeOf(%v): expect %s, got %s", err, code, CodeOf(err))
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	err := fmt.Errorf("wrap: %w", Errorf(NotFound, "no such method"))
+	_assert(errors.Is(err, NotFound), "expect errors.Is NotFound")
+	_assert(!errors.Is(err, Internal), "expect not errors.Is Internal")
+	_assert(errors.Is(err, Errorf(NotFound, "no such method")), "expect errors.Is an equal *Error")
+	_assert(!errors.Is(err, Errorf(NotFound, "other")), "expect not errors.Is an *Error with other message")
+	var e *Error
+	_assert(errors.As(err, &e) && e.Code == NotFound, "expect errors.As *Error")
+	_assert(statusOf(err).Message == err.Error(), "statusOf should keep the wrapped message")
+}
+
+func TestServer_StatusCodes(t *testing.T) {
+	_, addr := startTestServer(t, &Echo{}, &Waiter{canceled: make(chan error, 1)})
+	client, err := Dial("tcp", addr, &Option{HandleTimeout: 100 * time.Millisecond})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx := context.Background()
+	var reply int
+	err = client.Call(ctx, "Echo.Unknown", Args{}, &reply)
+	_assert(errors.Is(err, NotFound), "expect NotFound, got %s: %v", CodeOf(err), err)
+	err = client.Call(ctx, "Echo", Args{}, &reply)
+	_assert(errors.Is(err, InvalidArgument), "expect InvalidArgument, got %s: %v", CodeOf(err), err)
+	err = client.Call(ctx, "Echo.Panic", Args{}, &reply)
+	_assert(errors.Is(err, Internal), "expect Internal, got %s: %v", CodeOf(err), err)
+	err = client.Call(ctx, "Waiter.Wait", Args{}, &reply)
+	_assert(errors.Is(err, DeadlineExceeded), "expect DeadlineExceeded, got %s: %v", CodeOf(err), err)
+
+	// the code and details chosen by the method are kept
+	err = client.Call(ctx, "Echo.Fail", Unavailable, &reply)
+	var e *Error
+	_assert(errors.As(err, &e) && e.Code == Unavailable, "expect Unavailable, got %v", err)
+	_assert(e.Message == "Echo.Fail: fail" && e.Details["field"] == "num", "unexpected status %+v", e)
+
+	// a call given up by the client reports the code of ctx
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = client.Call(cctx, "Waiter.Wait", Args{}, &reply)
+	_assert(errors.Is(err, Canceled), "expect Canceled, got %s: %v", CodeOf(err), err)
+}
@@ -0,0 +1,375 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"github.com/bswaterb/goX/brpc/codec"
+	"io"
+	"log"
+	"sync"
+)
+
+// StreamKind 方法的流式类型，由方法签名中 *ServerStream 参数的位置决定
+//
+//	Unary:           func(args, *reply) error
+//	ServerStreaming: func(args, *ServerStream) error
+//	ClientStreaming: func(*ServerStream, *reply) error
+//	BidiStreaming:   func(*ServerStream) error
+//
+// 以上签名都可以在最前面加上 context.Context 参数
+type StreamKind int
+
+const (
+	Unary StreamKind = iota
+	ServerStreaming
+	ClientStreaming
+	BidiStreaming
+)
+
+func (k StreamKind) String() string {
+	switch k {
+	case Unary:
+		return "unary"
+	case ServerStreaming:
+		return "server-streaming"
+	case ClientStreaming:
+		return "client-streaming"
+	case BidiStreaming:
+		return "bidi-streaming"
+	}
+	return "unknown"
+}
+
+// streamWindow 是流控窗口的大小，单位为消息条数。
+// 每个方向上发送方最多领先接收方 streamWindow 条消息，接收方每消费一半窗口就归还一次额度
+const streamWindow = 32
+
+var (
+	// errStreamFinished is returned by ServerStream.Send once the method has returned
+	errStreamFinished = errors.New("rpc server: stream is finished")
+	// errFlowControl means the peer sent more messages than the window allows
+	errFlowControl = &Error{Code: ResourceExhausted, Message: "rpc: stream flow control violated"}
+)
+
+// window counts how many messages may still be sent to the peer
+type window struct {
+	mu     sync.Mutex
+	credit int
+	notify chan struct{}
+}
+
+func newWindow(n int) *window {
+	return &window{credit: n, notify: make(chan struct{}, 1)}
+}
+
+// acquire takes one credit, it blocks until there is one, ctx is done or done is closed
+func (w *window) acquire(ctx context.Context, done <-chan struct{}) error {
+	for {
+		w.mu.Lock()
+		if w.credit > 0 {
+			w.credit--
+			more := w.credit > 0
+			w.mu.Unlock()
+			if more {
+				w.wake() // let other senders go on
+			}
+			return nil
+		}
+		w.mu.Unlock()
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return io.EOF
+		}
+	}
+}
+
+// release gives back n credits granted by the peer
+func (w *window) release(n int) {
+	w.mu.Lock()
+	w.credit += n
+	w.mu.Unlock()
+	w.wake()
+}
+
+func (w *window) wake() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// stream is the part shared by ServerStream and ClientStream
+type stream struct {
+	seq        uint64
+	sendWindow *window
+	// grant tells the peer that n more messages can be sent
+	grant func(n int)
+
+	mu       sync.Mutex // protect following
+	recvq    chan *codec.RawBody
+	closed   bool // recvq is closed, no more message will arrive
+	consumed int  // messages received since the last window update
+}
+
+func newStream(seq uint64, grant func(n int)) *stream {
+	return &stream{
+		seq:        seq,
+		sendWindow: newWindow(streamWindow),
+		grant:      grant,
+		recvq:      make(chan *codec.RawBody, streamWindow),
+	}
+}
+
+// push queues a message read from the connection, it never blocks the read loop.
+// It returns false if the peer ignored the window and the queue is full.
+func (s *stream) push(raw *codec.RawBody) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true // nobody is receiving any more, drop it
+	}
+	select {
+	case s.recvq <- raw:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeRecv marks the end of the incoming messages, queued ones can still be received
+func (s *stream) closeRecv() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.recvq)
+	}
+}
+
+// recv takes the next message and decodes it into msg, it returns io.EOF at the end of messages
+func (s *stream) recv(ctx context.Context, msg any) error {
+	// queued messages are not delivered once the call is given up
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var raw *codec.RawBody
+	var ok bool
+	select {
+	case raw, ok = <-s.recvq:
+		if !ok {
+			return io.EOF
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	s.consumed++
+	n := 0
+	if s.consumed >= streamWindow/2 {
+		n, s.consumed = s.consumed, 0
+	}
+	s.mu.Unlock()
+	if n > 0 {
+		s.grant(n)
+	}
+	return raw.Decode(msg)
+}
+
+// ServerStream is passed to streaming methods, messages are sent and received in order.
+// Send and Recv may be called from different goroutines, but not concurrently with themselves.
+type ServerStream struct {
+	*stream
+	ctx context.Context
+	sc  *serverConn
+	// finished is set once the method has returned, protected by sc.sending,
+	// messages sent after that would follow the final response
+	finished bool
+}
+
+func newServerStream(sc *serverConn, seq uint64) *ServerStream {
+	st := &ServerStream{sc: sc}
+	st.stream = newStream(seq, func(n int) {
+		sc.sending.Lock()
+		defer sc.sending.Unlock()
+		_ = sc.cc.Write(&codec.Header{Seq: seq, Kind: codec.KindWindowUpdate, Window: uint32(n)}, nil)
+	})
+	return st
+}
+
+// Context returns the context of the call, the same one passed to the method
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send sends msg to the client, it blocks while the client falls behind by a whole window
+func (s *ServerStream) Send(msg any) error {
+	if err := s.sendWindow.acquire(s.ctx, nil); err != nil {
+		return err
+	}
+	s.sc.sending.Lock()
+	defer s.sc.sending.Unlock()
+	if s.finished {
+		return errStreamFinished
+	}
+	return s.sc.cc.Write(&codec.Header{Seq: s.seq, Kind: codec.KindStreamMsg}, msg)
+}
+
+// Recv receives the next message from the client into msg,
+// it returns io.EOF once the client has called CloseSend
+func (s *ServerStream) Recv(msg any) error {
+	return s.recv(s.ctx, msg)
+}
+
+// finish rejects later Send, so that no message follows the final response
+func (s *ServerStream) finish() {
+	s.sc.sending.Lock()
+	s.finished = true
+	s.sc.sending.Unlock()
+}
+
+// ClientStream is a streaming call created by Client.NewStream.
+// Send and Recv may be called from different goroutines, but not concurrently with themselves.
+type ClientStream struct {
+	*stream
+	ctx    context.Context
+	client *Client
+	call   *Call
+	// final is the body of the final response, decoded by CloseAndRecv
+	final    codec.RawBody
+	finished chan struct{} // closed once the final response arrives or the call fails
+	once     sync.Once
+	sendDone bool // CloseSend has been called, protected by client.sending
+}
+
+// NewStream starts a streaming call of serviceMethod. args is sent along with the call
+// for server-streaming methods and should be nil for the others.
+// The deadline and outgoing metadata of ctx are sent as in Call,
+// once ctx is done the server is told to stop the call.
+func (client *Client) NewStream(ctx context.Context, serviceMethod string, args any) (*ClientStream, error) {
+	cs := &ClientStream{ctx: ctx, client: client, finished: make(chan struct{})}
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Resp:          &cs.final,
+		Done:          make(chan *Call, 1),
+		stream:        cs,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		call.deadline = deadline
+	}
+	call.Metadata, _ = FromOutgoingContext(ctx)
+	cs.call = call
+	// the grant is only used after the call is sent, so Seq is known by then
+	cs.stream = newStream(0, func(n int) {
+		client.sending.Lock()
+		defer client.sending.Unlock()
+		h := codec.Header{Seq: call.Seq, Kind: codec.KindWindowUpdate, Window: uint32(n)}
+		if err := client.cc.Write(&h, nil); err != nil {
+			log.Println("rpc client: send window update error:", err)
+		}
+	})
+	client.send(call)
+	if call.Seq == 0 {
+		// not registered, the call has failed already
+		return nil, call.Error
+	}
+	cs.seq = call.Seq
+	go cs.watch()
+	return cs, nil
+}
+
+// watch tells the server to stop the call once ctx is done before the call finishes
+func (cs *ClientStream) watch() {
+	select {
+	case <-cs.ctx.Done():
+		if call := cs.client.removeCall(cs.seq); call != nil {
+			cs.client.sendCancel(cs.seq)
+			call.Error = callFailed(cs.ctx)
+			call.done()
+		}
+	case <-cs.finished:
+	}
+}
+
+// finish is called by Call.done, exactly once
+func (cs *ClientStream) finish() {
+	cs.once.Do(func() {
+		cs.closeRecv()
+		close(cs.finished)
+	})
+}
+
+// Context returns the context passed to NewStream
+func (cs *ClientStream) Context() context.Context {
+	return cs.ctx
+}
+
+// Send sends msg to the server, it blocks while the server falls behind by a whole window.
+// It returns io.EOF once the call has finished, Recv tells the reason.
+func (cs *ClientStream) Send(msg any) error {
+	if err := cs.sendWindow.acquire(cs.ctx, cs.finished); err != nil {
+		return err
+	}
+	cs.client.sending.Lock()
+	defer cs.client.sending.Unlock()
+	select {
+	case <-cs.finished:
+		return io.EOF
+	default:
+	}
+	if cs.sendDone {
+		return errors.New("rpc client: send on closed stream")
+	}
+	return cs.client.cc.Write(&codec.Header{Seq: cs.seq, Kind: codec.KindStreamMsg}, msg)
+}
+
+// CloseSend tells the server that no more message will be sent, it's safe to call it more than once
+func (cs *ClientStream) CloseSend() error {
+	cs.client.sending.Lock()
+	defer cs.client.sending.Unlock()
+	if cs.sendDone {
+		return nil
+	}
+	cs.sendDone = true
+	select {
+	case <-cs.finished:
+		return nil
+	default:
+	}
+	return cs.client.cc.Write(&codec.Header{Seq: cs.seq, Kind: codec.KindStreamEnd}, nil)
+}
+
+// Recv receives the next message from the server into msg. Once the server method has returned
+// it returns io.EOF if the call succeeded, or the error of the call otherwise.
+func (cs *ClientStream) Recv(msg any) error {
+	err := cs.recv(cs.ctx, msg)
+	if err == io.EOF {
+		// recvq is closed only when the call is finished
+		if cs.call.Error != nil {
+			return cs.call.Error
+		}
+	}
+	return err
+}
+
+// CloseAndRecv closes the sending side and waits for the reply of a client-streaming method
+func (cs *ClientStream) CloseAndRecv(reply any) error {
+	if err := cs.CloseSend(); err != nil {
+		return err
+	}
+	select {
+	case <-cs.finished:
+	case <-cs.ctx.Done():
+		return callFailed(cs.ctx)
+	}
+	if cs.call.Error != nil {
+		return cs.call.Error
+	}
+	if md, ok := cs.ctx.Value(replyReceiverKey{}).(*Metadata); ok {
+		*md = cs.call.ReplyMetadata
+	}
+	return cs.final.Decode(reply)
+}
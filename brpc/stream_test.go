@@ -0,0 +1,305 @@
+package brpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bswaterb/goX/brpc/codec"
+)
+
+type Streamer struct {
+	sent int64 // messages sent by Tail
+}
+
+// Count sends 0..n-1
+func (s *Streamer) Count(n int, st *ServerStream) error {
+	for i := 0; i < n; i++ {
+		if err := st.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tail sends forever until the client goes away
+func (s *Streamer) Tail(ctx context.Context, args Args, st *ServerStream) error {
+	for i := 0; ; i++ {
+		if err := st.Send(i); err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.sent, 1)
+	}
+}
+
+// Sum adds up the numbers sent by the client
+func (s *Streamer) Sum(st *ServerStream, reply *int) error {
+	for {
+		var n int
+		err := st.Recv(&n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*reply += n
+	}
+}
+
+// Echo sends back every message, it fails once it receives a negative number
+func (s *Streamer) Echo(ctx context.Context, st *ServerStream) error {
+	for {
+		var n int
+		err := st.Recv(&n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return errors.New("negative number")
+		}
+		if err = st.Send(n); err != nil {
+			return err
+		}
+	}
+}
+
+// TooMany takes two streams, it's not a valid method
+func (s *Streamer) TooMany(a *ServerStream, b *ServerStream) error {
+	return nil
+}
+
+func startStreamServer(t *testing.T) (*Streamer, string) {
+	t.Helper()
+	var s Streamer
+	_, addr := startTestServer(t, &s)
+	return &s, addr
+}
+
+func TestNewService_StreamKinds(t *testing.T) {
+	s := newService(&Streamer{})
+	_assert(len(s.method) == 4, "wrong service Method, expect 4, but got %d", len(s.method))
+	for name, kind := range map[string]StreamKind{
+		"Count": ServerStreaming,
+		"Tail":  ServerStreaming,
+		"Sum":   ClientStreaming,
+		"Echo":  BidiStreaming,
+	} {
+		mType := s.method[name]
+		_assert(mType != nil && mType.StreamKind == kind, "%s: expect %s", name, kind)
+	}
+}
+
+func TestStream_ServerStreaming(t *testing.T) {
+	_, addr := startStreamServer(t)
+	for _, typ := range []codec.Type{codec.TypeGob, codec.TypeJson} {
+		client, err := Dial("tcp", addr, &Option{CodecType: typ})
+		_assert(err == nil, "%s: dial error: %v", typ, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		// more than a window, the server has to wait for window updates
+		const n = streamWindow*3 + 1
+		st, err := client.NewStream(ctx, "Streamer.Count", n)
+		_assert(err == nil, "%s: failed to start stream: %v", typ, err)
+		var got int
+		for {
+			var i int
+			err = st.Recv(&i)
+			if err != nil {
+				break
+			}
+			_assert(i == got, "%s: expect %d, got %d", typ, got, i)
+			got++
+		}
+		_assert(err == io.EOF && got == n, "%s: expect %d messages and io.EOF, got %d and %v", typ, n, got, err)
+		cancel()
+		_ = client.Close()
+	}
+}
+
+func TestStream_ClientStreaming(t *testing.T) {
+	_, addr := startStreamServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := client.NewStream(ctx, "Streamer.Sum", nil)
+	_assert(err == nil, "failed to start stream: %v", err)
+	want := 0
+	for i := 1; i <= streamWindow*3; i++ {
+		_assert(st.Send(i) == nil, "failed to send %d", i)
+		want += i
+	}
+	var reply int
+	err = st.CloseAndRecv(&reply)
+	_assert(err == nil && reply == want, "expect %d, got %d, err %v", want, reply, err)
+}
+
+func TestStream_Bidi(t *testing.T) {
+	_, addr := startStreamServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := client.NewStream(ctx, "Streamer.Echo", nil)
+	_assert(err == nil, "failed to start stream: %v", err)
+	const n = streamWindow * 3
+	go func() {
+		for i := 0; i < n; i++ {
+			if st.Send(i) != nil {
+				return
+			}
+		}
+		_ = st.CloseSend()
+	}()
+	got := 0
+	for ; ; got++ {
+		var i int
+		if err = st.Recv(&i); err != nil {
+			break
+		}
+		_assert(i == got, "expect %d, got %d", got, i)
+	}
+	_assert(err == io.EOF && got == n, "expect %d messages and io.EOF, got %d and %v", n, got, err)
+
+	// the error returned by the method ends the stream
+	st, err = client.NewStream(ctx, "Streamer.Echo", nil)
+	_assert(err == nil, "failed to start stream: %v", err)
+	_assert(st.Send(1) == nil && st.Send(-1) == nil, "failed to send")
+	var i int
+	_assert(st.Recv(&i) == nil && i == 1, "expect echo 1")
+	err = st.Recv(&i)
+	_assert(err != nil && strings.Contains(err.Error(), "negative number"), "expect method error, got %v", err)
+	_assert(st.Send(2) == io.EOF, "send after the end of stream should return io.EOF")
+}
+
+func TestStream_FlowControlAndCancel(t *testing.T) {
+	s, addr := startStreamServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st, err := client.NewStream(ctx, "Streamer.Tail", &Args{})
+	_assert(err == nil, "failed to start stream: %v", err)
+	// nothing is received, so the server stops after a whole window
+	time.Sleep(100 * time.Millisecond)
+	_assert(atomic.LoadInt64(&s.sent) == streamWindow, "expect %d messages sent, got %d", streamWindow, atomic.LoadInt64(&s.sent))
+
+	// receiving half of the window lets the server go on
+	for i := 0; i < streamWindow/2; i++ {
+		_assert(st.Recv(new(int)) == nil, "failed to receive")
+	}
+	time.Sleep(100 * time.Millisecond)
+	sent := atomic.LoadInt64(&s.sent)
+	_assert(sent == streamWindow+streamWindow/2, "expect %d messages sent, got %d", streamWindow+streamWindow/2, sent)
+
+	cancel()
+	err = st.Recv(new(int))
+	_assert(err != nil, "expect error after cancel")
+	// the server stops the method instead of blocking on Send forever
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	st, err = client.NewStream(ctx, "Streamer.Sum", nil)
+	_assert(err == nil, "failed to start stream: %v", err)
+	var reply int
+	_assert(st.Send(1) == nil && st.CloseAndRecv(&reply) == nil && reply == 1, "the connection should still work")
+}
+
+func TestStream_FlowControlViolated(t *testing.T) {
+	// writes on a pipe block until the other side reads, so the sending lock stays held
+	conn, peer := net.Pipe()
+	defer func() { _ = peer.Close() }()
+	go func() {
+		var opt Option
+		if receiveMessageWithDelimiter(peer, &opt) != nil || sendMessageWithDelimiter(peer, &handshakeReply{Accept: true}) != nil {
+			return
+		}
+		cc := codec.GetCodecFunc(opt.CodecType)(peer)
+		var h codec.Header
+		if cc.ReadHeader(&h) != nil || cc.ReadBody(nil) != nil {
+			return
+		}
+		// let the client block in Send, then overrun the window without reading anything
+		time.Sleep(100 * time.Millisecond)
+		for i := 0; i <= streamWindow; i++ {
+			if cc.Write(&codec.Header{Seq: h.Seq, Kind: codec.KindStreamMsg}, i) != nil {
+				return
+			}
+		}
+	}()
+	client, err := NewClient(conn, DefaultOption)
+	_assert(err == nil, "new client error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	st, err := client.NewStream(context.Background(), "Streamer.Echo", nil)
+	_assert(err == nil, "failed to start stream: %v", err)
+	go func() { _ = st.Send(1) }()
+
+	// nothing is received, Recv would grant the window and wait for the sending lock as well
+	select {
+	case <-st.finished:
+		_assert(errors.Is(st.call.Error, errFlowControl), "expect %v, got %v", errFlowControl, st.call.Error)
+	case <-time.After(time.Second):
+		t.Fatal("the stream isn't ended while a writer is blocked")
+	}
+}
+
+// unluckyCodec fails to read the stream messages of 13 on the server side
+type unluckyCodec struct {
+	codec.Codec
+}
+
+func (c unluckyCodec) ReadBody(body interface{}) error {
+	if err := c.Codec.ReadBody(body); err != nil {
+		return err
+	}
+	var n int
+	if raw, ok := body.(*codec.RawBody); ok && raw.Decode(&n) == nil && n == 13 {
+		return errors.New("unlucky number")
+	}
+	return nil
+}
+
+func TestStream_BadMessageDropped(t *testing.T) {
+	const typ = codec.Type("application/x-brpc-unlucky")
+	_ = codec.Register(typ, func(conn io.ReadWriteCloser) codec.Codec {
+		return unluckyCodec{codec.NewJsonCodec(conn)}
+	})
+	_, addr := startStreamServer(t)
+	client, err := Dial("tcp", addr, &Option{CodecType: typ})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := client.NewStream(ctx, "Streamer.Echo", nil)
+	_assert(err == nil, "failed to start stream: %v", err)
+	for _, n := range []int{1, 13, 2} {
+		_assert(st.Send(n) == nil, "failed to send %d", n)
+	}
+	_assert(st.CloseSend() == nil, "failed to close send")
+	// the bad message is dropped, it doesn't end the stream with an error reply
+	var got []int
+	for {
+		var n int
+		if err = st.Recv(&n); err != nil {
+			break
+		}
+		got = append(got, n)
+	}
+	_assert(err == io.EOF, "expect io.EOF, got %v", err)
+	_assert(len(got) == 2 && got[0] == 1 && got[1] == 2, "expect [1 2], got %v", got)
+}
@@ -0,0 +1,159 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// Node is a server for Balancer to choose from
+type Node struct {
+	Addr string
+	// Weight comes from WeightedDiscovery, it's at least 1
+	Weight int
+	// Pending is the number of calls waiting for their replies on the connection to Addr,
+	// 0 if there is no connection yet
+	Pending int
+}
+
+// Balancer chooses the server for each call of XClient, see XClient.SetBalancer.
+// nodes is never empty, and Pick may be called concurrently.
+type Balancer interface {
+	Pick(ctx context.Context, nodes []Node) (string, error)
+}
+
+// BalancerFunc adapts an ordinary function to Balancer
+type BalancerFunc func(ctx context.Context, nodes []Node) (string, error)
+
+func (f BalancerFunc) Pick(ctx context.Context, nodes []Node) (string, error) {
+	return f(ctx, nodes)
+}
+
+// ringBalancer is a Balancer whose state is built from all servers, such as ConsistentHash,
+// it's given all servers along with the candidates so that excluding some doesn't change the state
+type ringBalancer interface {
+	pickFrom(ctx context.Context, all, nodes []Node) (string, error)
+}
+
+var errNoServers = errors.New("rpc balancer: no available servers")
+
+// WeightedRoundRobin is the smooth weighted round-robin of nginx,
+// a server of weight 3 is picked 3 times as often, and the picks are interleaved
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[string]int // current weight of each server
+}
+
+// NewWeightedRoundRobin creates a WeightedRoundRobin
+func NewWeightedRoundRobin() *WeightedRoundRobin {
+	return &WeightedRoundRobin{current: make(map[string]int)}
+}
+
+func (b *WeightedRoundRobin) Pick(_ context.Context, nodes []Node) (string, error) {
+	if len(nodes) == 0 {
+		return "", errNoServers
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[string]int, len(nodes)) // forget the servers which are gone
+	total, best := 0, ""
+	for _, n := range nodes {
+		total += n.Weight
+		current[n.Addr] = b.current[n.Addr] + n.Weight
+		if best == "" || current[n.Addr] > current[best] {
+			best = n.Addr
+		}
+	}
+	current[best] -= total
+	b.current = current
+	return best, nil
+}
+
+// LeastPending picks the server with the fewest pending calls, ties are broken randomly
+type LeastPending struct{}
+
+func (LeastPending) Pick(_ context.Context, nodes []Node) (string, error) {
+	if len(nodes) == 0 {
+		return "", errNoServers
+	}
+	best, ties := 0, 1
+	for i := 1; i < len(nodes); i++ {
+		switch {
+		case nodes[i].Pending < nodes[best].Pending:
+			best, ties = i, 1
+		case nodes[i].Pending == nodes[best].Pending:
+			// reservoir sampling keeps each tie with the same chance
+			ties++
+			if rand.Intn(ties) == 0 {
+				best = i
+			}
+		}
+	}
+	return nodes[best].Addr, nil
+}
+
+// P2C is power of two choices: it picks two servers randomly and uses the one with fewer
+// pending calls, which avoids herding on the least loaded server when its load is stale
+type P2C struct{}
+
+func (P2C) Pick(_ context.Context, nodes []Node) (string, error) {
+	switch len(nodes) {
+	case 0:
+		return "", errNoServers
+	case 1:
+		return nodes[0].Addr, nil
+	}
+	i := rand.Intn(len(nodes))
+	j := rand.Intn(len(nodes) - 1)
+	if j >= i {
+		j++
+	}
+	if nodes[j].Pending < nodes[i].Pending {
+		i = j
+	}
+	return nodes[i].Addr, nil
+}
+
+// balance asks xc.balancer to choose from the candidates of the servers, see candidates
+func (xc *XClient) balance(ctx context.Context, tried map[string]bool) (string, error) {
+	all, err := xc.nodes()
+	if err != nil {
+		return "", err
+	}
+	nodes := candidates(all, func(n Node) string { return n.Addr }, tried, xc.admit)
+	if len(nodes) == 0 {
+		return "", errNoServers
+	}
+	if rb, ok := xc.balancer.(ringBalancer); ok {
+		return rb.pickFrom(ctx, all, nodes)
+	}
+	return xc.balancer.Pick(ctx, nodes)
+}
+
+// nodes returns the servers in discovery along with their weights and pending calls
+func (xc *XClient) nodes() ([]Node, error) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var weights map[string]int
+	if wd, ok := xc.d.(WeightedDiscovery); ok {
+		if weights, err = wd.Weights(); err != nil {
+			return nil, err
+		}
+	}
+	nodes := make([]Node, len(servers))
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for i, addr := range servers {
+		nodes[i] = Node{Addr: addr, Weight: 1}
+		if w, ok := weights[addr]; ok && w > 1 {
+			nodes[i].Weight = w
+		}
+		if client := xc.clients[addr]; client != nil && client.IsAvailable() {
+			nodes[i].Pending = client.NumPending()
+		}
+	}
+	return nodes, nil
+}
@@ -13,3 +13,10 @@ type Discovery interface {
 	Get(mode SelectMode) (string, error)
 	GetAll() ([]string, error)
 }
+
+// WeightedDiscovery is a Discovery which also knows the weights of the servers,
+// the weighted balancers use them, a server missing from the weights weighs 1
+type WeightedDiscovery interface {
+	Discovery
+	Weights() (map[string]int, error)
+}
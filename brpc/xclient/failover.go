@@ -0,0 +1,189 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	. "github.com/bswaterb/goX/brpc"
+)
+
+// FailoverPolicy controls how XClient.Call retries a failed call on another server.
+//
+// A call is retried only if its error is in RetryableCodes, and either the call never
+// reached the server (see brpc.ErrNotSent and brpc.ErrServerShutdown), or the method is
+// marked idempotent. Calls which fail to dial the server count as Unavailable.
+type FailoverPolicy struct {
+	// MaxAttempts 包括第一次调用在内的最多尝试次数，小于等于 1 表示不重试
+	MaxAttempts int
+	// RetryableCodes 可以重试的错误类别，连接错误与 ErrShutdown 属于 Unavailable
+	RetryableCodes []Code
+	// Idempotent 标记幂等的方法，如 "Foo.Sum"，它们即使已到达服务端也可以重试
+	Idempotent map[string]bool
+	// 第 n 次重试前等待 BaseBackoff*2^(n-1)，不超过 MaxBackoff（0 表示不限），并随机抖动到 [d/2, d]
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultFailoverPolicy is used by the XClient created by NewXClient,
+// it only retries the calls which never reached a server
+var DefaultFailoverPolicy = FailoverPolicy{
+	MaxAttempts:    3,
+	RetryableCodes: []Code{Unavailable},
+	BaseBackoff:    10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+// retryable reports whether the call of serviceMethod failed with err can be retried
+func (p *FailoverPolicy) retryable(serviceMethod string, err error) bool {
+	code := CodeOf(err)
+	// the server rejects the requests before handling them while shutting down
+	reached := !errors.Is(err, ErrServerShutdown)
+	if errors.Is(err, ErrNotSent) {
+		code, reached = Unavailable, false
+	}
+	if reached && !p.Idempotent[serviceMethod] {
+		return false
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the n-th retry, MaxBackoff 0 means no cap
+func (p *FailoverPolicy) delay(n int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff) && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// jitter keeps the clients from retrying in lockstep
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// backoff waits before the n-th retry, it returns ctx.Err() if ctx is done first
+func (p *FailoverPolicy) backoff(ctx context.Context, n int) error {
+	d := p.delay(n)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetFailover replaces the failover policy of xc, nil disables failover.
+// It should be called before making calls.
+func (xc *XClient) SetFailover(p *FailoverPolicy) {
+	xc.failover = p
+}
+
+// failoverCall calls serviceMethod on the servers chosen by discovery, retrying as the policy allows
+func (xc *XClient) failoverCall(ctx context.Context, serviceMethod string, args, reply any) error {
+	attempts := 1
+	if xc.failover != nil && xc.failover.MaxAttempts > 1 {
+		attempts = xc.failover.MaxAttempts
+	}
+	tried := make(map[string]bool)
+	var err error
+	for n := 0; n < attempts; n++ {
+		if n > 0 {
+			if !xc.failover.retryable(serviceMethod, err) || xc.failover.backoff(ctx, n) != nil {
+				return err
+			}
+		}
+		rpcAddr, e := xc.pick(ctx, tried)
+		if e != nil {
+			if err != nil {
+				return err // report the failure of the last attempt
+			}
+			return e
+		}
+		tried[rpcAddr] = true
+		if err = xc.call(rpcAddr, ctx, serviceMethod, args, reply); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// pick chooses a server by the balancer or xc.mode, skipping the ones in tried and the ejected ones.
+// If no server is left, the ejected ones are chosen from, and then the tried ones.
+func (xc *XClient) pick(ctx context.Context, tried map[string]bool) (string, error) {
+	xc.pruneOutliers()
+	if xc.balancer != nil {
+		return xc.balance(ctx, tried)
+	}
+	rpcAddr, err := xc.d.Get(xc.mode)
+	if err != nil || !tried[rpcAddr] && xc.admit(rpcAddr) {
+		return rpcAddr, err
+	}
+	all, err := xc.d.GetAll()
+	if err != nil {
+		return "", err
+	}
+	servers := candidates(all, func(s string) string { return s }, tried, xc.admit)
+	if len(servers) == 0 {
+		return rpcAddr, nil
+	}
+	// ask the discovery again rather than choosing by ourselves,
+	// so that round-robin moves on past the excluded servers
+	allowed := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		allowed[s] = true
+	}
+	for i := 1; i < len(all); i++ {
+		if rpcAddr, err = xc.d.Get(xc.mode); err != nil {
+			return "", err
+		}
+		if allowed[rpcAddr] {
+			return rpcAddr, nil
+		}
+	}
+	return servers[rand.Intn(len(servers))], nil
+}
+
+// candidates returns the items neither tried nor ejected. If there is none, it returns
+// the untried ones, and if all have been tried, it returns all of them.
+func candidates[T any](items []T, addrOf func(T) string, tried map[string]bool, admit func(string) bool) []T {
+	untried := make([]T, 0, len(items))
+	for _, item := range items {
+		if !tried[addrOf(item)] {
+			untried = append(untried, item)
+		}
+	}
+	if len(untried) == 0 {
+		return items
+	}
+	admitted := make([]T, 0, len(untried))
+	for _, item := range untried {
+		if admit(addrOf(item)) {
+			admitted = append(admitted, item)
+		}
+	}
+	if len(admitted) == 0 {
+		return untried
+	}
+	return admitted
+}
+
+// notSent marks err of a call which never reached rpcAddr
+func notSent(rpcAddr string, err error) error {
+	return fmt.Errorf("%w: dial %s: %w", ErrNotSent, rpcAddr, err)
+}
@@ -0,0 +1,93 @@
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bswaterb/goX/cachex/consistent_hash"
+)
+
+type hashKey struct{}
+
+// WithHashKey returns a ctx telling ConsistentHash to route the call by key,
+// so that the calls for the same entity land on the same server
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// HashKeyFrom returns the key set by WithHashKey
+func HashKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	return key, ok
+}
+
+const defaultReplicas = 50
+
+// ConsistentHash routes the calls by the key set by WithHashKey on a hash ring
+// of cachex/consistent_hash, the calls without a key are routed randomly.
+// A server of weight w takes w times the virtual nodes. The ring is built from all servers
+// in discovery and rebuilt only once they or their weights change, the servers excluded
+// from a call (tried, or ejected by outlier detection) are skipped clockwise on the ring.
+type ConsistentHash struct {
+	replicas int
+	hash     consistent_hash.Hash
+	mu       sync.Mutex // protect following
+	ring     *consistent_hash.Map
+	id       string // the servers and weights the ring is built from
+}
+
+// NewConsistentHash creates a ConsistentHash, each server of weight 1 takes replicas virtual nodes
+// on the ring. If replicas is 0, a default one is used, and if fn is nil, crc32 is used.
+func NewConsistentHash(replicas int, fn consistent_hash.Hash) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &ConsistentHash{replicas: replicas, hash: fn}
+}
+
+func (b *ConsistentHash) Pick(ctx context.Context, nodes []Node) (string, error) {
+	return b.pickFrom(ctx, nodes, nodes)
+}
+
+// pickFrom picks one of nodes on the ring of all
+func (b *ConsistentHash) pickFrom(ctx context.Context, all, nodes []Node) (string, error) {
+	if len(nodes) == 0 {
+		return "", errNoServers
+	}
+	key, ok := HashKeyFrom(ctx)
+	if !ok {
+		return nodes[rand.Intn(len(nodes))].Addr, nil
+	}
+	allowed := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		allowed[n.Addr] = true
+	}
+	return b.ringOf(all).GetNodeFunc(key, func(addr string) bool { return allowed[addr] })
+}
+
+// ringOf returns the ring of nodes, it's rebuilt if nodes differ from the last call
+func (b *ConsistentHash) ringOf(nodes []Node) *consistent_hash.Map {
+	sorted := make([]Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Addr < sorted[j].Addr })
+	var id strings.Builder
+	for _, n := range sorted {
+		id.WriteString(n.Addr + "*" + strconv.Itoa(n.Weight) + ",")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ring != nil && b.id == id.String() {
+		return b.ring
+	}
+	ring := consistent_hash.NewConsistentHashMap(b.hash)
+	for _, n := range sorted {
+		ring.AddNodes(consistent_hash.Node{Id: n.Addr, VirtualNodeNums: b.replicas * n.Weight})
+	}
+	b.ring, b.id = ring, id.String()
+	return ring
+}
@@ -15,8 +15,11 @@ type MultiServersDiscovery struct {
 	mu      sync.RWMutex // protect following
 	servers []string
 	index   int // record the selected position for robin algorithm
+	weights map[string]int
 }
 
+var _ WeightedDiscovery = (*MultiServersDiscovery)(nil)
+
 // NewMultiServerDiscovery creates a MultiServersDiscovery instance
 func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
 	d := &MultiServersDiscovery{
@@ -69,3 +72,24 @@ func (d *MultiServersDiscovery) GetAll() ([]string, error) {
 	copy(servers, d.servers)
 	return servers, nil
 }
+
+// SetWeights replaces the weights of the servers, see WeightedDiscovery
+func (d *MultiServersDiscovery) SetWeights(weights map[string]int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.weights = make(map[string]int, len(weights))
+	for addr, w := range weights {
+		d.weights[addr] = w
+	}
+}
+
+// Weights returns a copy of the weights set by SetWeights
+func (d *MultiServersDiscovery) Weights() (map[string]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	weights := make(map[string]int, len(d.weights))
+	for addr, w := range d.weights {
+		weights[addr] = w
+	}
+	return weights, nil
+}
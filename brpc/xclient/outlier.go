@@ -0,0 +1,173 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	. "github.com/bswaterb/goX/brpc"
+)
+
+// OutlierPolicy controls the passive health checking of XClient: the calls to each server
+// are tracked in windows, and a server whose error rate or average latency in a window
+// crosses the threshold is ejected, the selection skips it until the cooldown passes.
+// Then it's re-admitted gradually, its chance to be selected grows from 0 to 1 over RampUp.
+// If all servers are ejected, they are all selected as usual.
+type OutlierPolicy struct {
+	// Window 统计的时间窗口，窗口结束后重新计数
+	Window time.Duration
+	// MinRequests 窗口内的调用少于 MinRequests 时不摘除节点
+	MinRequests int
+	// MaxErrorRate 窗口内失败调用的比例超过它时摘除节点，0 表示不按错误率摘除
+	MaxErrorRate float64
+	// MaxLatency 窗口内调用的平均耗时超过它时摘除节点，0 表示不按延迟摘除
+	MaxLatency time.Duration
+	// ErrorCodes 计为失败的错误类别，其它错误（如业务错误）计为成功；被调用方取消的调用不计数，
+	// 调用方自己的 ctx 到期导致的 DeadlineExceeded 也不计数
+	ErrorCodes []Code
+	// Cooldown 节点被摘除的时长
+	Cooldown time.Duration
+	// RampUp 冷却结束后逐步恢复流量的时长，0 表示立即完全恢复
+	RampUp time.Duration
+}
+
+// DefaultOutlierPolicy is used by the XClient created by NewXClient, it ejects the servers
+// failing more than half of the calls, the latency is not checked as it depends on the service
+var DefaultOutlierPolicy = OutlierPolicy{
+	Window:       10 * time.Second,
+	MinRequests:  10,
+	MaxErrorRate: 0.5,
+	ErrorCodes:   []Code{Unavailable, DeadlineExceeded, Internal},
+	Cooldown:     30 * time.Second,
+	RampUp:       30 * time.Second,
+}
+
+// hostStats is the health of a server
+type hostStats struct {
+	start   time.Time // start of the window
+	calls   int
+	errors  int
+	latency time.Duration // sum of the latency of the calls in the window
+	until   time.Time     // the end of the cooldown, zero if never ejected
+}
+
+// outlierDetector tracks the health of the servers by OutlierPolicy
+type outlierDetector struct {
+	policy OutlierPolicy
+	now    func() time.Time
+	mu     sync.Mutex // protect following
+	hosts  map[string]*hostStats
+}
+
+func newOutlierDetector(p OutlierPolicy) *outlierDetector {
+	return &outlierDetector{policy: p, now: time.Now, hosts: make(map[string]*hostStats)}
+}
+
+// record counts a call to rpcAddr made with ctx, which completes with err after latency
+func (o *outlierDetector) record(ctx context.Context, rpcAddr string, err error, latency time.Duration) {
+	if errors.Is(err, Canceled) || errors.Is(err, DeadlineExceeded) && ctx.Err() != nil {
+		return // the caller gave up or ran out of its own time, it says nothing about the server
+	}
+	failed := false
+	if err != nil {
+		code := CodeOf(err)
+		for _, c := range o.policy.ErrorCodes {
+			failed = failed || c == code
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	h := o.hosts[rpcAddr]
+	if h == nil {
+		h = &hostStats{start: now}
+		o.hosts[rpcAddr] = h
+	}
+	if now.Before(h.until) {
+		return // ejected, the calls made anyway (by Broadcast, or as all servers are ejected) don't count
+	}
+	if now.Sub(h.start) >= o.policy.Window {
+		h.start, h.calls, h.errors, h.latency = now, 0, 0, 0
+	}
+	h.calls++
+	h.latency += latency
+	if failed {
+		h.errors++
+	}
+	if h.calls < o.policy.MinRequests {
+		return
+	}
+	p := o.policy
+	if p.MaxErrorRate > 0 && float64(h.errors) > p.MaxErrorRate*float64(h.calls) ||
+		p.MaxLatency > 0 && h.latency > p.MaxLatency*time.Duration(h.calls) {
+		// eject it, and count from a fresh window after the cooldown
+		h.until = now.Add(p.Cooldown)
+		h.start, h.calls, h.errors, h.latency = h.until, 0, 0, 0
+	}
+}
+
+// admit reports whether rpcAddr can be selected, a server being re-admitted
+// is selected by the chance growing over the ramp-up
+func (o *outlierDetector) admit(rpcAddr string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	h := o.hosts[rpcAddr]
+	if h == nil || h.until.IsZero() {
+		return true
+	}
+	since := o.now().Sub(h.until)
+	switch {
+	case since < 0:
+		return false
+	case since >= o.policy.RampUp:
+		h.until = time.Time{} // fully re-admitted
+		return true
+	}
+	return rand.Int63n(int64(o.policy.RampUp)) < int64(since)
+}
+
+// prune forgets the servers not in servers, so that the servers gone from discovery don't pile up,
+// and an address reused by a new server doesn't inherit the ejection of the old one
+func (o *outlierDetector) prune(servers []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.hosts) == 0 {
+		return
+	}
+	keep := make(map[string]bool, len(servers))
+	for _, addr := range servers {
+		keep[addr] = true
+	}
+	for addr := range o.hosts {
+		if !keep[addr] {
+			delete(o.hosts, addr)
+		}
+	}
+}
+
+// SetOutlierDetection replaces the outlier policy of xc, nil disables outlier ejection.
+// The health tracked so far is dropped. It should be called before making calls.
+func (xc *XClient) SetOutlierDetection(p *OutlierPolicy) {
+	xc.outlier = nil
+	if p != nil {
+		xc.outlier = newOutlierDetector(*p)
+	}
+}
+
+// admit reports whether rpcAddr is not ejected
+func (xc *XClient) admit(rpcAddr string) bool {
+	return xc.outlier == nil || xc.outlier.admit(rpcAddr)
+}
+
+// pruneOutliers drops the health tracked for the servers which have left discovery
+func (xc *XClient) pruneOutliers() {
+	if xc.outlier == nil {
+		return
+	}
+	if servers, err := xc.d.GetAll(); err == nil {
+		xc.outlier.prune(servers)
+	}
+}
@@ -0,0 +1,146 @@
+package xclient
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bswaterb/goX/brpc/registry"
+)
+
+// RegistryDiscovery is a discovery backed by a registry.Registry,
+// the servers are pulled from the registry again once they are older than timeout.
+// The registry is never asked while holding the lock of the servers, and as long as there are
+// servers known, Get and GetAll return them at once and leave the pull to the background.
+type RegistryDiscovery struct {
+	*MultiServersDiscovery
+	registry string
+	timeout  time.Duration
+	// protected by the lock of MultiServersDiscovery
+	lastUpdate time.Time
+	nextRetry  time.Time // a failed pull is not retried before then
+	refreshing bool      // a pull is running
+}
+
+const (
+	defaultUpdateTimeout = time.Second * 10
+	retryInterval        = time.Second
+)
+
+// NewRegistryDiscovery creates a RegistryDiscovery pulling from the registry at registerAddr,
+// such as http://localhost:9999/_brpc_/registry. If timeout is 0, a default one is used.
+func NewRegistryDiscovery(registerAddr string, timeout time.Duration) *RegistryDiscovery {
+	if timeout == 0 {
+		timeout = defaultUpdateTimeout
+	}
+	d := &RegistryDiscovery{
+		MultiServersDiscovery: NewMultiServerDiscovery(make([]string, 0)),
+		registry:              registerAddr,
+		timeout:               timeout,
+	}
+	return d
+}
+
+// Update the servers of discovery, they are replaced by the registry on the next refresh
+func (d *RegistryDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.lastUpdate = time.Now()
+	return nil
+}
+
+// Refresh pulls the servers from the registry if they are out of date,
+// it returns at once if another pull is running or the last one failed just now
+func (d *RegistryDiscovery) Refresh() error {
+	if ok, _ := d.claim(false); !ok {
+		return nil
+	}
+	return d.pull()
+}
+
+// Watch pulls the servers every timeout until ctx is done, so that they are always fresh
+// and the calls never trigger a pull. It blocks, run it in its own goroutine.
+func (d *RegistryDiscovery) Watch(ctx context.Context) {
+	t := time.NewTicker(d.timeout)
+	defer t.Stop()
+	for {
+		if ok, _ := d.claim(true); ok {
+			_ = d.pull()
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh is Refresh for Get and GetAll, the stale servers are pulled in the background
+// if there are any, the caller waits only if there is none
+func (d *RegistryDiscovery) refresh() error {
+	ok, hasServers := d.claim(false)
+	switch {
+	case !ok:
+		return nil
+	case hasServers:
+		go func() { _ = d.pull() }()
+		return nil
+	}
+	return d.pull()
+}
+
+// claim reports whether the caller should pull the servers, at most one pull runs at a time.
+// Unless force is true, fresh servers are not pulled, and neither are they right after a failure.
+func (d *RegistryDiscovery) claim(force bool) (ok, hasServers bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if d.refreshing || !force && (d.lastUpdate.Add(d.timeout).After(now) || now.Before(d.nextRetry)) {
+		return false, len(d.servers) > 0
+	}
+	d.refreshing = true
+	return true, len(d.servers) > 0
+}
+
+// pull asks the registry for the servers without holding the lock, then swaps them in
+func (d *RegistryDiscovery) pull() error {
+	log.Println("rpc registry: refresh servers from registry", d.registry)
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	servers, err := registry.Servers(ctx, d.registry)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshing = false
+	if err != nil {
+		log.Println("rpc registry refresh err:", err)
+		d.nextRetry = time.Now().Add(retryInterval)
+		return err
+	}
+	d.servers = servers
+	d.lastUpdate = time.Now()
+	return nil
+}
+
+// Get a server according to mode, the stale servers are still used if the registry can't be reached
+func (d *RegistryDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.refresh(); err != nil && !d.hasServers() {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+// GetAll returns all servers in discovery, the stale servers are still used if the registry can't be reached
+func (d *RegistryDiscovery) GetAll() ([]string, error) {
+	if err := d.refresh(); err != nil && !d.hasServers() {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
+
+func (d *RegistryDiscovery) hasServers() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.servers) > 0
+}
@@ -5,18 +5,47 @@ import (
 	. "github.com/bswaterb/goX/brpc"
 	"reflect"
 	"sync"
+	"time"
 )
 
 type XClient struct {
-	d       Discovery
-	mode    SelectMode
-	opt     *Option
-	mu      sync.Mutex // protect following
-	clients map[string]*Client
+	d            Discovery
+	mode         SelectMode
+	opt          *Option
+	interceptors []Interceptor
+	failover     *FailoverPolicy
+	balancer     Balancer
+	outlier      *outlierDetector
+	mu           sync.Mutex // protect following
+	clients      map[string]*Client
 }
 
+var _ Caller = (*XClient)(nil)
+
+// NewXClient creates an XClient failing over by DefaultFailoverPolicy and ejecting
+// the outliers by DefaultOutlierPolicy, see SetFailover and SetOutlierDetection
 func NewXClient(d Discovery, mode SelectMode, opt *Option) *XClient {
-	return &XClient{d: d, mode: mode, opt: opt, clients: make(map[string]*Client)}
+	failover := DefaultFailoverPolicy
+	return &XClient{
+		d:        d,
+		mode:     mode,
+		opt:      opt,
+		failover: &failover,
+		outlier:  newOutlierDetector(DefaultOutlierPolicy),
+		clients:  make(map[string]*Client),
+	}
+}
+
+// Use adds interceptors around every Call, and around the call to each server in Broadcast.
+// They run in the order they are added. It should be called before making calls.
+func (xc *XClient) Use(interceptors ...Interceptor) {
+	xc.interceptors = append(xc.interceptors, interceptors...)
+}
+
+// SetBalancer makes xc choose the servers by b instead of the select mode, nil goes back to the mode.
+// It should be called before making calls.
+func (xc *XClient) SetBalancer(b Balancer) {
+	xc.balancer = b
 }
 
 func (xc *XClient) Close() error {
@@ -51,22 +80,25 @@ func (xc *XClient) dial(rpcAddr string) (*Client, error) {
 }
 
 func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	start := time.Now()
 	client, err := xc.dial(rpcAddr)
 	if err != nil {
-		return err
+		err = notSent(rpcAddr, err)
+	} else {
+		err = client.Call(ctx, serviceMethod, args, reply)
+	}
+	if xc.outlier != nil {
+		xc.outlier.record(ctx, rpcAddr, err, time.Since(start))
 	}
-	return client.Call(ctx, serviceMethod, args, reply)
+	return err
 }
 
 // Call invokes the named function, waits for it to complete,
 // and returns its error status.
-// xc will choose a proper server.
+// xc will choose a proper server, and retry on other servers as the failover policy allows.
+// The interceptors run once around all the attempts.
 func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	rpcAddr, err := xc.d.Get(xc.mode)
-	if err != nil {
-		return err
-	}
-	return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+	return ChainInterceptors(xc.interceptors, xc.failoverCall)(ctx, serviceMethod, args, reply)
 }
 
 // Broadcast invokes the named function for every server registered in discovery
@@ -80,6 +112,7 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 	var e error
 	replyDone := reply == nil // if reply is nil, don't need to set value
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	for _, rpcAddr := range servers {
 		wg.Add(1)
 		go func(rpcAddr string) {
@@ -88,7 +121,9 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 			if reply != nil {
 				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
 			}
-			err := xc.call(rpcAddr, ctx, serviceMethod, args, clonedReply)
+			err := ChainInterceptors(xc.interceptors, func(ctx context.Context, serviceMethod string, args, reply any) error {
+				return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+			})(ctx, serviceMethod, args, clonedReply)
 			mu.Lock()
 			if err != nil && e == nil {
 				e = err
@@ -0,0 +1,593 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/bswaterb/goX/brpc"
+	"github.com/bswaterb/goX/brpc/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+type Foo struct {
+	addr string
+}
+
+type Args struct{ Num1, Num2 int }
+
+func (f *Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Addr replies the address of the server which handles the call
+func (f *Foo) Addr(args Args, reply *string) error {
+	*reply = f.addr
+	return nil
+}
+
+var unavailableCalls int64
+
+// Unavailable always fails after reaching the server
+func (f *Foo) Unavailable(args Args, reply *string) error {
+	atomic.AddInt64(&unavailableCalls, 1)
+	return Errorf(Unavailable, "foo on %s is unavailable", f.addr)
+}
+
+// deadAddr returns an address nobody listens on
+func deadAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	_ = l.Close()
+	return "tcp@" + l.Addr().String()
+}
+
+// startServers starts n servers and returns their addresses in protocol@addr format
+func startServers(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		addr := "tcp@" + l.Addr().String()
+		server := NewServer()
+		assert.NoError(t, server.Register(&Foo{addr: addr}))
+		go server.Accept(l)
+		t.Cleanup(func() { _ = l.Close() })
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func TestXClient_Use(t *testing.T) {
+	addrs := startServers(t, 2)
+	xc := NewXClient(NewMultiServerDiscovery(addrs), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var mu sync.Mutex
+	var calls []string
+	xc.Use(func(ctx context.Context, serviceMethod string, args, reply any, next Invoker) error {
+		err := next(ctx, serviceMethod, args, reply)
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s=%d", serviceMethod, *reply.(*int)))
+		mu.Unlock()
+		return err
+	})
+
+	var reply int
+	assert.NoError(t, xc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply))
+	assert.Equal(t, 3, reply)
+	assert.Equal(t, []string{"Foo.Sum=3"}, calls)
+
+	// every server called by Broadcast goes through the interceptors
+	calls = nil
+	assert.NoError(t, xc.Broadcast(context.Background(), "Foo.Sum", Args{Num1: 2, Num2: 2}, &reply))
+	assert.Equal(t, []string{"Foo.Sum=4", "Foo.Sum=4"}, calls)
+}
+
+func TestRegistryDiscovery(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	addrs := startServers(t, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, registry.Heartbeat(ctx, ts.URL, addrs[0], 0))
+
+	d := NewRegistryDiscovery(ts.URL, 100*time.Millisecond)
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var addr string
+	assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+	assert.Equal(t, addrs[0], addr)
+
+	// the new server shows up after the next refresh
+	assert.NoError(t, registry.Heartbeat(ctx, ts.URL, addrs[1], 0))
+	servers, err := d.GetAll()
+	assert.NoError(t, err)
+	assert.Equal(t, addrs[:1], servers)
+	// the stale servers are returned at once while they are pulled in the background
+	time.Sleep(150 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		servers, err = d.GetAll()
+		return err == nil && len(servers) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, addrs, servers)
+
+	// the servers known are still used while the registry is down
+	ts.Close()
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+
+	_, err = NewRegistryDiscovery(ts.URL, time.Second).Get(RandomSelect)
+	assert.Error(t, err)
+}
+
+func TestRegistryDiscovery_SlowRegistry(t *testing.T) {
+	var requests int64
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	// the known servers are used at once, and only one request waits on the registry
+	d := NewRegistryDiscovery(ts.URL, 10*time.Millisecond)
+	assert.NoError(t, d.Update([]string{"tcp@127.0.0.1:1"}))
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr, err := d.Get(RandomSelect)
+			assert.NoError(t, err)
+			assert.Equal(t, "tcp@127.0.0.1:1", addr)
+		}()
+	}
+	wg.Wait()
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&requests) == 1 }, time.Second, time.Millisecond)
+
+	// a failed pull is not retried right away
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return !d.refreshing
+	}, time.Second, time.Millisecond)
+	for i := 0; i < 10; i++ {
+		_, err := d.GetAll()
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt64(&requests))
+}
+
+func TestRegistryDiscovery_Watch(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := NewRegistryDiscovery(ts.URL, 20*time.Millisecond)
+	go d.Watch(ctx)
+	assert.NoError(t, registry.Heartbeat(ctx, ts.URL, "tcp@127.0.0.1:1", 0))
+	// the servers are pulled without any call to Get
+	assert.Eventually(t, func() bool {
+		servers, _ := d.MultiServersDiscovery.GetAll()
+		return len(servers) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestXClient_Failover(t *testing.T) {
+	t.Run("dial failure", func(t *testing.T) {
+		addrs := append(startServers(t, 1), deadAddr(t))
+		xc := NewXClient(NewMultiServerDiscovery(addrs), RoundRobinSelect, nil)
+		defer func() { _ = xc.Close() }()
+		for i := 0; i < 4; i++ {
+			var addr string
+			assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+			assert.Equal(t, addrs[0], addr)
+		}
+
+		// without failover, the dead server is reported
+		xc.SetFailover(nil)
+		var failed int
+		for i := 0; i < 4; i++ {
+			var addr string
+			if err := xc.Call(context.Background(), "Foo.Addr", Args{}, &addr); err != nil {
+				assert.ErrorIs(t, err, ErrNotSent)
+				assert.Equal(t, Unavailable, CodeOf(err))
+				failed++
+			}
+		}
+		assert.Equal(t, 2, failed)
+	})
+
+	t.Run("server shutdown", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		server := NewServer()
+		assert.NoError(t, server.Register(&Foo{addr: "tcp@" + l.Addr().String()}))
+		go server.Accept(l)
+		addrs := append([]string{"tcp@" + l.Addr().String()}, startServers(t, 1)...)
+
+		d := NewMultiServerDiscovery(addrs[:1])
+		xc := NewXClient(d, RoundRobinSelect, nil)
+		defer func() { _ = xc.Close() }()
+		var addr string
+		assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+		assert.NoError(t, server.Shutdown(context.Background()))
+		// a call racing with the shutdown may have reached the server, it's not retried
+		assert.Eventually(t, func() bool {
+			xc.mu.Lock()
+			defer xc.mu.Unlock()
+			return !xc.clients[addrs[0]].IsAvailable()
+		}, time.Second, 5*time.Millisecond)
+
+		// the connection to the first server is gone, the calls go to the second one
+		assert.NoError(t, d.Update(addrs))
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+			assert.Equal(t, addrs[1], addr)
+		}
+	})
+
+	t.Run("reached server", func(t *testing.T) {
+		addrs := startServers(t, 2)
+		xc := NewXClient(NewMultiServerDiscovery(addrs), RoundRobinSelect, nil)
+		defer func() { _ = xc.Close() }()
+
+		atomic.StoreInt64(&unavailableCalls, 0)
+		var reply string
+		err := xc.Call(context.Background(), "Foo.Unavailable", Args{}, &reply)
+		assert.ErrorIs(t, err, Unavailable)
+		assert.EqualValues(t, 1, atomic.LoadInt64(&unavailableCalls), "non-idempotent call is retried")
+
+		policy := DefaultFailoverPolicy
+		policy.Idempotent = map[string]bool{"Foo.Unavailable": true}
+		xc.SetFailover(&policy)
+		atomic.StoreInt64(&unavailableCalls, 0)
+		err = xc.Call(context.Background(), "Foo.Unavailable", Args{}, &reply)
+		assert.ErrorIs(t, err, Unavailable)
+		assert.EqualValues(t, 3, atomic.LoadInt64(&unavailableCalls))
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{deadAddr(t), deadAddr(t)}), RandomSelect, nil)
+		defer func() { _ = xc.Close() }()
+		policy := DefaultFailoverPolicy
+		policy.BaseBackoff, policy.MaxBackoff = time.Hour, time.Hour
+		xc.SetFailover(&policy)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		var reply string
+		err := xc.Call(ctx, "Foo.Addr", Args{}, &reply)
+		assert.ErrorIs(t, err, ErrNotSent, "the error of the last attempt is returned")
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestXClient_PickRoundRobin(t *testing.T) {
+	xc := NewXClient(NewMultiServerDiscovery([]string{"a", "b", "c", "d"}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.outlier.hosts["d"] = &hostStats{until: time.Now().Add(time.Hour)}
+
+	// the tried and the ejected servers are skipped, the others still take turns
+	var picks []string
+	for i := 0; i < 8; i++ {
+		addr, err := xc.pick(context.Background(), map[string]bool{"b": true})
+		assert.NoError(t, err)
+		picks = append(picks, addr)
+	}
+	for i, addr := range picks {
+		assert.Contains(t, []string{"a", "c"}, addr)
+		if i > 0 {
+			assert.NotEqual(t, picks[i-1], addr, "round-robin should alternate, got %v", picks)
+		}
+	}
+}
+
+func TestFailoverPolicy_Delay(t *testing.T) {
+	for _, c := range []struct {
+		max      time.Duration
+		n        int
+		min, cap time.Duration
+	}{
+		{max: 0, n: 1, min: 5 * time.Millisecond, cap: 10 * time.Millisecond},
+		{max: 0, n: 4, min: 40 * time.Millisecond, cap: 80 * time.Millisecond}, // 0 means no cap
+		{max: 30 * time.Millisecond, n: 4, min: 15 * time.Millisecond, cap: 30 * time.Millisecond},
+	} {
+		p := FailoverPolicy{BaseBackoff: 10 * time.Millisecond, MaxBackoff: c.max}
+		for i := 0; i < 20; i++ {
+			d := p.delay(c.n)
+			assert.GreaterOrEqual(t, d, c.min, "max %s, n %d", c.max, c.n)
+			assert.LessOrEqual(t, d, c.cap, "max %s, n %d", c.max, c.n)
+		}
+	}
+	assert.Zero(t, (&FailoverPolicy{}).delay(3))
+}
+
+func TestBalancers(t *testing.T) {
+	t.Run("weighted round robin", func(t *testing.T) {
+		b := NewWeightedRoundRobin()
+		nodes := []Node{{Addr: "a", Weight: 5}, {Addr: "b", Weight: 1}, {Addr: "c", Weight: 1}}
+		var picks []string
+		for i := 0; i < 7; i++ {
+			addr, err := b.Pick(context.Background(), nodes)
+			assert.NoError(t, err)
+			picks = append(picks, addr)
+		}
+		assert.Equal(t, []string{"a", "a", "b", "a", "c", "a", "a"}, picks)
+	})
+
+	t.Run("least pending", func(t *testing.T) {
+		nodes := []Node{{Addr: "a", Pending: 3}, {Addr: "b", Pending: 1}, {Addr: "c", Pending: 1}, {Addr: "d", Pending: 2}}
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			addr, err := LeastPending{}.Pick(context.Background(), nodes)
+			assert.NoError(t, err)
+			seen[addr] = true
+		}
+		assert.Equal(t, map[string]bool{"b": true, "c": true}, seen)
+	})
+
+	t.Run("p2c", func(t *testing.T) {
+		nodes := []Node{{Addr: "a", Pending: 0}, {Addr: "b", Pending: 5}, {Addr: "c", Pending: 9}}
+		for i := 0; i < 100; i++ {
+			addr, err := P2C{}.Pick(context.Background(), nodes)
+			assert.NoError(t, err)
+			assert.NotEqual(t, "c", addr, "the busiest server is never picked")
+		}
+		addr, err := P2C{}.Pick(context.Background(), nodes[:1])
+		assert.NoError(t, err)
+		assert.Equal(t, "a", addr)
+	})
+
+	for _, b := range []Balancer{NewWeightedRoundRobin(), LeastPending{}, P2C{}} {
+		_, err := b.Pick(context.Background(), nil)
+		assert.Error(t, err)
+	}
+}
+
+func TestXClient_SetBalancer(t *testing.T) {
+	addrs := startServers(t, 2)
+	d := NewMultiServerDiscovery(addrs)
+	d.SetWeights(map[string]int{addrs[0]: 3})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBalancer(NewWeightedRoundRobin())
+
+	count := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		var addr string
+		assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+		count[addr]++
+	}
+	assert.Equal(t, map[string]int{addrs[0]: 6, addrs[1]: 2}, count)
+
+	// a custom balancer sees the pending calls of each server
+	var mu sync.Mutex
+	var pending []int
+	xc.SetBalancer(BalancerFunc(func(ctx context.Context, nodes []Node) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, n := range nodes {
+			pending = append(pending, n.Pending)
+		}
+		return LeastPending{}.Pick(ctx, nodes)
+	}))
+	var addr string
+	assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+	assert.Equal(t, []int{0, 0}, pending)
+}
+
+func TestConsistentHash(t *testing.T) {
+	addrs := startServers(t, 3)
+	d := NewMultiServerDiscovery(addrs)
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBalancer(NewConsistentHash(0, nil))
+
+	// the ports are random and so is the ring, the keys are taken until a ring
+	// of the same servers puts some of them on every server
+	ring := NewConsistentHash(0, nil)
+	nodes := make([]Node, len(addrs))
+	for i, addr := range addrs {
+		nodes[i] = Node{Addr: addr, Weight: 1}
+	}
+	var keys []string
+	owners := make(map[string]bool)
+	for i := 0; i < 30 || len(owners) < len(addrs); i++ {
+		key := fmt.Sprintf("user-%d", i)
+		owner, err := ring.Pick(WithHashKey(context.Background(), key), nodes)
+		assert.NoError(t, err)
+		owners[owner] = true
+		keys = append(keys, key)
+	}
+
+	route := func() map[string]string {
+		routes := make(map[string]string)
+		for _, key := range keys {
+			var addr string
+			assert.NoError(t, xc.Call(WithHashKey(context.Background(), key), "Foo.Addr", Args{}, &addr))
+			routes[key] = addr
+		}
+		return routes
+	}
+	routes := route()
+	assert.Equal(t, routes, route(), "the same key goes to the same server")
+	used := make(map[string]bool)
+	for _, addr := range routes {
+		used[addr] = true
+	}
+	assert.Len(t, used, 3)
+
+	// only the keys of the removed server move
+	assert.NoError(t, d.Update(addrs[:2]))
+	for key, addr := range route() {
+		if routes[key] != addrs[2] {
+			assert.Equal(t, routes[key], addr, key)
+		} else {
+			assert.NotEqual(t, addrs[2], addr, key)
+		}
+	}
+
+	// calls without a key are still served
+	var addr string
+	assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+}
+
+func TestConsistentHash_Excluded(t *testing.T) {
+	all := []Node{{Addr: "a", Weight: 1}, {Addr: "b", Weight: 2}, {Addr: "c", Weight: 1}}
+	b := NewConsistentHash(0, nil)
+	routes := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		addr, err := b.pickFrom(WithHashKey(context.Background(), key), all, all)
+		assert.NoError(t, err)
+		routes[key] = addr
+	}
+	ring := b.ring
+
+	// the excluded server is skipped on the same ring, only its keys move
+	for key, want := range routes {
+		addr, err := b.pickFrom(WithHashKey(context.Background(), key), all, []Node{all[0], all[2]})
+		assert.NoError(t, err)
+		if want != "b" {
+			assert.Equal(t, want, addr, key)
+		} else {
+			assert.NotEqual(t, "b", addr, key)
+		}
+	}
+	assert.Same(t, ring, b.ring, "the ring should not be rebuilt for the excluded servers")
+}
+
+func TestOutlierDetector(t *testing.T) {
+	now := time.Now()
+	o := newOutlierDetector(OutlierPolicy{
+		Window:       time.Minute,
+		MinRequests:  4,
+		MaxErrorRate: 0.5,
+		MaxLatency:   10 * time.Millisecond,
+		ErrorCodes:   []Code{Unavailable},
+		Cooldown:     time.Minute,
+		RampUp:       time.Minute,
+	})
+	o.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// business errors, canceled calls and the calls out of the caller's own time say nothing about the server
+	expired, cancel := context.WithDeadline(ctx, time.Now())
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		o.record(ctx, "a", Errorf(Unknown, "business"), time.Millisecond)
+		o.record(ctx, "a", Errorf(Canceled, "canceled"), time.Hour)
+		o.record(expired, "a", Errorf(DeadlineExceeded, "timeout"), time.Millisecond)
+	}
+	assert.True(t, o.admit("a"))
+
+	// but the deadline of the server counts while the caller is still waiting
+	o.policy.ErrorCodes = append(o.policy.ErrorCodes, DeadlineExceeded)
+	for i := 0; i < 4; i++ {
+		o.record(ctx, "f", Errorf(DeadlineExceeded, "handle timeout"), time.Millisecond)
+	}
+	assert.False(t, o.admit("f"))
+	o.policy.ErrorCodes = o.policy.ErrorCodes[:1]
+
+	o.record(ctx, "b", nil, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		o.record(ctx, "b", Errorf(Unavailable, "down"), time.Millisecond)
+	}
+	assert.False(t, o.admit("b"), "3 of 4 calls failed")
+
+	for i := 0; i < 4; i++ {
+		o.record(ctx, "c", nil, 20*time.Millisecond)
+	}
+	assert.False(t, o.admit("c"), "too slow")
+
+	// the failures in an old window are forgotten
+	for i := 0; i < 3; i++ {
+		o.record(ctx, "d", Errorf(Unavailable, "down"), time.Millisecond)
+	}
+	now = now.Add(time.Minute)
+	o.record(ctx, "d", Errorf(Unavailable, "down"), time.Millisecond)
+	assert.True(t, o.admit("d"))
+
+	// half way through the ramp-up, about half of the selections are admitted
+	now = now.Add(30 * time.Second)
+	admitted := 0
+	for i := 0; i < 1000; i++ {
+		if o.admit("b") {
+			admitted++
+		}
+	}
+	assert.InDelta(t, 500, admitted, 150)
+	now = now.Add(30 * time.Second)
+	assert.True(t, o.admit("b"))
+	assert.True(t, o.admit("c"))
+
+	// the servers gone are forgotten, a new server at the same address starts afresh
+	for i := 0; i < 4; i++ {
+		o.record(ctx, "e", Errorf(Unavailable, "down"), time.Millisecond)
+	}
+	assert.False(t, o.admit("e"))
+	o.prune([]string{"a", "b"})
+	assert.Len(t, o.hosts, 2)
+	assert.True(t, o.admit("e"))
+}
+
+func TestXClient_OutlierDetection(t *testing.T) {
+	addrs := append(startServers(t, 1), deadAddr(t))
+	xc := NewXClient(NewMultiServerDiscovery(addrs), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetFailover(nil)
+	policy := DefaultOutlierPolicy
+	policy.MinRequests = 2
+	xc.SetOutlierDetection(&policy)
+
+	var failed int
+	for i := 0; i < 10; i++ {
+		var addr string
+		if err := xc.Call(context.Background(), "Foo.Addr", Args{}, &addr); err != nil {
+			failed++
+			continue
+		}
+		assert.Equal(t, addrs[0], addr)
+	}
+	assert.Equal(t, 2, failed, "the dead server is ejected after 2 failures")
+	assert.False(t, xc.admit(addrs[1]))
+
+	// the ejected server is still used if no other server is left
+	xc.SetOutlierDetection(&policy)
+	for i := 0; i < 4; i++ {
+		var addr string
+		_ = xc.Call(context.Background(), "Foo.Addr", Args{}, &addr)
+	}
+	assert.NoError(t, xc.d.Update(addrs[1:]))
+	var addr string
+	assert.ErrorIs(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr), ErrNotSent)
+
+	// the server gone from discovery is forgotten by the next call
+	assert.NoError(t, xc.d.Update(addrs[:1]))
+	assert.NoError(t, xc.Call(context.Background(), "Foo.Addr", Args{}, &addr))
+	xc.outlier.mu.Lock()
+	assert.NotContains(t, xc.outlier.hosts, addrs[1])
+	xc.outlier.mu.Unlock()
+}
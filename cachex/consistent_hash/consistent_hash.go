@@ -9,6 +9,7 @@ import (
 
 var (
 	ErrHashNotInit = errors.New("哈希环未初始化")
+	ErrNoNode      = errors.New("哈希环中没有可用的节点")
 )
 
 type Hash func(data []byte) uint32
@@ -71,26 +72,54 @@ func (m *Map) Set(key string, value any) {
 		fmt.Println("哈希环中不包含数据节点，请先添加节点以初始化一致性哈希结构")
 		return
 	}
-	keyHash := m.hashFunc([]byte(key))
+	node := m.locate(key)
+	fmt.Println("当前 key 命中的节点是: ", node.Id)
+	node.kvStorage.db[key] = value
+}
 
-	mappingIdx := sort.Search(len(m.sortedHashes), func(i int) bool {
-		return m.sortedHashes[i] >= int(keyHash)
-	})
-	if mappingIdx == len(m.sortedHashes) {
-		mappingIdx = 0
+func (m *Map) Get(key string) (any, error) {
+	if len(m.sortedHashes) == 0 {
+		return "", ErrHashNotInit
 	}
 
-	nodeHash := m.sortedHashes[mappingIdx]
-	node := m.nodesMap[nodeHash]
+	node := m.locate(key)
 	fmt.Println("当前 key 命中的节点是: ", node.Id)
-	node.kvStorage.db[key] = value
+
+	return node.kvStorage.db[key], nil
 }
 
-func (m *Map) Get(key string) (any, error) {
+// GetNode 返回 key 在哈希环上命中的节点 Id，不读写节点中的数据
+func (m *Map) GetNode(key string) (string, error) {
 	if len(m.sortedHashes) == 0 {
 		return "", ErrHashNotInit
 	}
+	return m.locate(key).Id, nil
+}
 
+// GetNodeFunc 从 key 命中的位置顺时针查找，跳过 accept 返回 false 的节点，
+// 返回第一个被接受的节点 Id；没有节点被接受时返回 ErrNoNode
+func (m *Map) GetNodeFunc(key string, accept func(id string) bool) (string, error) {
+	if len(m.sortedHashes) == 0 {
+		return "", ErrHashNotInit
+	}
+	idx := m.search(key)
+	for i := 0; i < len(m.sortedHashes); i++ {
+		node := m.nodesMap[m.sortedHashes[(idx+i)%len(m.sortedHashes)]]
+		if accept(node.Id) {
+			return node.Id, nil
+		}
+	}
+	return "", ErrNoNode
+}
+
+// locate 顺时针找到 key 之后的第一个虚拟节点，调用方需保证哈希环非空
+func (m *Map) locate(key string) *Node {
+	nodeHash := m.sortedHashes[m.search(key)]
+	return m.nodesMap[nodeHash]
+}
+
+// search 返回 key 之后第一个虚拟节点在 sortedHashes 中的下标，调用方需保证哈希环非空
+func (m *Map) search(key string) int {
 	keyHash := m.hashFunc([]byte(key))
 
 	mappingIdx := sort.Search(len(m.sortedHashes), func(i int) bool {
@@ -100,10 +129,5 @@ func (m *Map) Get(key string) (any, error) {
 	if mappingIdx == len(m.sortedHashes) {
 		mappingIdx = 0
 	}
-
-	nodeHash := m.sortedHashes[mappingIdx]
-	node := m.nodesMap[nodeHash]
-	fmt.Println("当前 key 命中的节点是: ", node.Id)
-
-	return node.kvStorage.db[key], nil
+	return mappingIdx
 }
@@ -35,3 +35,46 @@ func TestConsistentHash(t *testing.T) {
 	}
 
 }
+
+func TestMap_GetNode(t *testing.T) {
+	h := NewConsistentHashMap(nil)
+	_, err := h.GetNode("k")
+	assert.ErrorIs(t, err, ErrHashNotInit)
+
+	h.AddNodes(Node{Id: "node1", VirtualNodeNums: 10}, Node{Id: "node2", VirtualNodeNums: 10})
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		id, err := h.GetNode(k)
+		assert.NoError(t, err)
+		again, _ := h.GetNode(k)
+		assert.Equal(t, id, again)
+		seen[id] = true
+	}
+	assert.Equal(t, map[string]bool{"node1": true, "node2": true}, seen)
+}
+
+func TestMap_GetNodeFunc(t *testing.T) {
+	h := NewConsistentHashMap(nil)
+	_, err := h.GetNodeFunc("k", func(string) bool { return true })
+	assert.ErrorIs(t, err, ErrHashNotInit)
+
+	h.AddNodes(Node{Id: "node1", VirtualNodeNums: 10}, Node{Id: "node2", VirtualNodeNums: 10}, Node{Id: "node3", VirtualNodeNums: 10})
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		id, _ := h.GetNode(k)
+		got, err := h.GetNodeFunc(k, func(string) bool { return true })
+		assert.NoError(t, err)
+		assert.Equal(t, id, got)
+		// the keys of a skipped node move to the others, the rest stay
+		got, err = h.GetNodeFunc(k, func(n string) bool { return n != "node1" })
+		assert.NoError(t, err)
+		if id != "node1" {
+			assert.Equal(t, id, got, k)
+		} else {
+			assert.NotEqual(t, "node1", got, k)
+		}
+	}
+	_, err = h.GetNodeFunc("k", func(string) bool { return false })
+	assert.ErrorIs(t, err, ErrNoNode)
+}
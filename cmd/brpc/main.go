@@ -0,0 +1,274 @@
+// brpc is a command-line tool to poke brpc servers.
+//
+//	brpc [flags] <protocol@addr> list [service]
+//	brpc [flags] <protocol@addr> call <Service.Method> [json args]
+//
+// The address is in the format of brpc.XDial, such as tcp@127.0.0.1:9999 or http@127.0.0.1:8080.
+// list asks the server what it offers through _brpc.Describe, call invokes a method over
+// the JSON codec and prints the reply. With -n greater than 1, call runs as a quick load test
+// and prints the latency summary instead of the replies.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bswaterb/goX/brpc"
+	"github.com/bswaterb/goX/brpc/codec"
+)
+
+func main() {
+	// the library logs every connection, keep the output clean
+	log.SetOutput(io.Discard)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type config struct {
+	timeout     time.Duration
+	n           int
+	concurrency int
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("brpc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var cfg config
+	fs.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "timeout of each call, 0 means no limit")
+	fs.IntVar(&cfg.n, "n", 1, "number of calls to make")
+	fs.IntVar(&cfg.concurrency, "c", 1, "number of calls to make concurrently, used with -n")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage:")
+		_, _ = fmt.Fprintln(stderr, "  brpc [flags] <protocol@addr> list [service]")
+		_, _ = fmt.Fprintln(stderr, "  brpc [flags] <protocol@addr> call <Service.Method> [json args]")
+		_, _ = fmt.Fprintln(stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	args = fs.Args()
+	if len(args) < 2 || cfg.n < 1 || cfg.concurrency < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	client, err := brpc.XDial(args[0], &brpc.Option{CodecType: codec.TypeJson, ConnectTimeout: cfg.timeout})
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "brpc: dial error:", err)
+		return 1
+	}
+	defer func() { _ = client.Close() }()
+
+	switch cmd := args[1]; {
+	case cmd == "list" && len(args) <= 3:
+		service := ""
+		if len(args) == 3 {
+			service = args[2]
+		}
+		err = list(client, cfg, service, stdout)
+	case cmd == "call" && (len(args) == 3 || len(args) == 4):
+		var params json.RawMessage
+		if len(args) == 4 {
+			params = json.RawMessage(args[3])
+			if !json.Valid(params) {
+				_, _ = fmt.Fprintln(stderr, "brpc: args is not valid json:", args[3])
+				return 2
+			}
+		}
+		if cfg.n == 1 {
+			err = call(client, cfg, args[2], params, stdout)
+		} else {
+			err = bench(client, cfg, args[2], params, stdout)
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "brpc:", err)
+		return 1
+	}
+	return 0
+}
+
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// list prints the methods of the services, the structure of the types is expanded for one service
+func list(client *brpc.Client, cfg config, service string, w io.Writer) error {
+	ctx, cancel := withTimeout(cfg.timeout)
+	defer cancel()
+	services, err := brpc.Describe(ctx, client, service)
+	if err != nil {
+		return err
+	}
+	for _, sd := range services {
+		_, _ = fmt.Fprintln(w, sd.Name)
+		for _, m := range sd.Methods {
+			_, _ = fmt.Fprintf(w, "  %s\n", signature(sd.Name, m, service != ""))
+		}
+	}
+	return nil
+}
+
+// signature formats m as a Go func, streaming positions are shown as *brpc.ServerStream
+func signature(service string, m brpc.MethodDesc, expand bool) string {
+	params := make([]string, 0, 2)
+	for _, td := range []*brpc.TypeDesc{m.ArgType, m.ReplyType} {
+		switch {
+		case td == nil && (m.StreamKind == brpc.BidiStreaming && len(params) > 0):
+			// bidi-streaming methods take the stream only
+		case td == nil:
+			params = append(params, "*brpc.ServerStream")
+		case expand:
+			params = append(params, typeString(td, "  "))
+		default:
+			params = append(params, td.Name)
+		}
+	}
+	s := fmt.Sprintf("%s.%s(%s) error", service, m.Name, strings.Join(params, ", "))
+	if m.StreamKind != brpc.Unary {
+		s += " [" + m.StreamKind.String() + "]"
+	}
+	return s
+}
+
+// typeString formats td, named structs are expanded into their fields
+func typeString(td *brpc.TypeDesc, indent string) string {
+	switch td.Kind {
+	case "ptr":
+		return "*" + typeString(td.Elem, indent)
+	case "slice":
+		return "[]" + typeString(td.Elem, indent)
+	case "map":
+		return "map[" + typeString(td.Key, indent) + "]" + typeString(td.Elem, indent)
+	case "struct":
+		if len(td.Fields) == 0 {
+			return td.Name
+		}
+		var b strings.Builder
+		b.WriteString(td.Name + " {\n")
+		for _, f := range td.Fields {
+			b.WriteString(indent + "  " + f.Name + " " + typeString(f.Type, indent+"  "))
+			if f.Tag != "" {
+				b.WriteString(" `" + f.Tag + "`")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "}")
+		return b.String()
+	}
+	return td.Name
+}
+
+func call(client *brpc.Client, cfg config, serviceMethod string, params json.RawMessage, w io.Writer) error {
+	ctx, cancel := withTimeout(cfg.timeout)
+	defer cancel()
+	var reply json.RawMessage
+	if err := client.Call(ctx, serviceMethod, argsOf(params), &reply); err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		reply = json.RawMessage("null") // the method replied nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, reply, "", "  "); err != nil {
+		// not possible for a reply decoded by the json codec, print it anyway
+		out.Reset()
+		out.Write(reply)
+	}
+	_, _ = fmt.Fprintln(w, out.String())
+	return nil
+}
+
+// argsOf returns nil for empty params, the server gets the zero value
+func argsOf(params json.RawMessage) any {
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// bench makes cfg.n calls with cfg.concurrency workers and prints the latency summary
+func bench(client *brpc.Client, cfg config, serviceMethod string, params json.RawMessage, w io.Writer) error {
+	var (
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, cfg.n)
+		failed    int
+		firstErr  error
+	)
+	jobs := make(chan struct{}, cfg.n)
+	for i := 0; i < cfg.n; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				ctx, cancel := withTimeout(cfg.timeout)
+				var reply json.RawMessage
+				begin := time.Now()
+				err := client.Call(ctx, serviceMethod, argsOf(params), &reply)
+				elapsed := time.Since(begin)
+				cancel()
+				mu.Lock()
+				if err != nil {
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					latencies = append(latencies, elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	total := time.Since(start)
+
+	_, _ = fmt.Fprintf(w, "calls:    %d, succeeded %d, failed %d\n", cfg.n, len(latencies), failed)
+	_, _ = fmt.Fprintf(w, "total:    %s, %.1f calls/s\n", total.Round(time.Microsecond), float64(cfg.n)/total.Seconds())
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var sum time.Duration
+		for _, d := range latencies {
+			sum += d
+		}
+		_, _ = fmt.Fprintf(w, "latency:  min %s, avg %s, p50 %s, p99 %s, max %s\n",
+			latencies[0], sum/time.Duration(len(latencies)), percentile(latencies, 50),
+			percentile(latencies, 99), latencies[len(latencies)-1])
+	}
+	if firstErr != nil {
+		return errors.New("first error: " + firstErr.Error())
+	}
+	return nil
+}
+
+// percentile returns the p-th percentile of the sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
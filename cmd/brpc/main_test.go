@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/bswaterb/goX/brpc"
+	"github.com/stretchr/testify/assert"
+)
+
+type Args struct {
+	Num1 int `json:"num1"`
+	Num2 int `json:"num2"`
+}
+
+type Arith struct{}
+
+func (a Arith) Mul(args Args, reply *int) error {
+	*reply = args.Num1 * args.Num2
+	return nil
+}
+
+func (a Arith) Div(args Args, reply *float64) error {
+	if args.Num2 == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = float64(args.Num1) / float64(args.Num2)
+	return nil
+}
+
+func (a Arith) Tail(ctx context.Context, st *brpc.ServerStream) error {
+	return nil
+}
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	server := brpc.NewServer()
+	assert.NoError(t, server.Register(Arith{}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+func runCmd(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_List(t *testing.T) {
+	addr := startServer(t)
+	code, out, _ := runCmd(addr, "list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Arith\n"+
+		"  Arith.Div(main.Args, *float64) error\n"+
+		"  Arith.Mul(main.Args, *int) error\n"+
+		"  Arith.Tail(*brpc.ServerStream) error [bidi-streaming]\n", out)
+
+	code, out, _ = runCmd(addr, "list", "Arith")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "  Arith.Mul(main.Args {\n"+
+		"    Num1 int `json:\"num1\"`\n"+
+		"    Num2 int `json:\"num2\"`\n"+
+		"  }, *int) error\n")
+
+	code, _, errOut := runCmd(addr, "list", "Unknown")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "can't find service Unknown")
+}
+
+func TestRun_Call(t *testing.T) {
+	addr := startServer(t)
+	code, out, _ := runCmd("-timeout", "1s", addr, "call", "Arith.Mul", `{"num1": 3, "num2": 4}`)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "12\n", out)
+
+	// no args means the zero value
+	code, _, errOut := runCmd(addr, "call", "Arith.Div")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "divide by zero")
+
+	code, _, errOut = runCmd(addr, "call", "Arith.Mul", `{num1: 3}`)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut, "not valid json")
+
+	code, _, _ = runCmd(addr, "unknown")
+	assert.Equal(t, 2, code)
+	code, _, errOut = runCmd("tcp@127.0.0.1:1", "list")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "dial error")
+}
+
+func TestRun_Bench(t *testing.T) {
+	addr := startServer(t)
+	code, out, _ := runCmd("-n", "100", "-c", "4", addr, "call", "Arith.Mul", `{"num1": 3, "num2": 4}`)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "calls:    100, succeeded 100, failed 0")
+	assert.True(t, strings.Contains(out, "latency:  min "), out)
+
+	code, out, errOut := runCmd("-n", "10", addr, "call", "Arith.Div", `{"num1": 3}`)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out, "succeeded 0, failed 10")
+	assert.Contains(t, errOut, "first error: divide by zero")
+}
@@ -0,0 +1,323 @@
+// brpcgen generates typed client wrappers for brpc services.
+//
+// It reads the methods of the given types which can be published by brpc.Server.Register,
+// that is func(args, *reply) error or func(ctx context.Context, args, *reply) error,
+// and emits a <Type>Client for each type. Streaming methods are skipped.
+// Typical usage is a go:generate directive next to the service type:
+//
+//	//go:generate go run github.com/bswaterb/goX/cmd/brpcgen -type Foo
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const generatedHeader = "// Code generated by brpcgen. DO NOT EDIT."
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of service type names; required")
+	output    = flag.String("output", "", "output file name; default <type>_brpc.go")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("brpcgen: ")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: brpcgen -type T [-output file] [directory]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+	src, err := generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := *output
+	if name == "" {
+		name = strings.ToLower(types[0]) + "_brpc.go"
+	}
+	if err = os.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// method is a method of the service which can be called by the generated client
+type method struct {
+	Name      string
+	ArgType   string
+	ReplyType string     // type of reply without the leading *
+	types     []ast.Expr // the types of args and reply, their packages are imported by the client
+}
+
+type serviceType struct {
+	Name    string
+	Methods []method
+}
+
+// generate parses the package in dir and returns the source of the clients of types
+func generate(dir string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		if pkg != nil {
+			return nil, fmt.Errorf("more than one package in %s", dir)
+		}
+		pkg = p
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf("no go file in %s", dir)
+	}
+
+	wanted := make(map[string]*serviceType)
+	for _, name := range types {
+		wanted[name] = &serviceType{Name: name}
+	}
+	imports := map[string]string{"context": "", "github.com/bswaterb/goX/brpc": ""}
+	for _, file := range pkg.Files {
+		if isGenerated(file) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || !fd.Name.IsExported() {
+				continue
+			}
+			svc := wanted[receiverName(fd.Recv.List[0].Type)]
+			if svc == nil {
+				continue
+			}
+			m, ok := methodOf(file, fd)
+			if !ok {
+				continue
+			}
+			if err = addImports(imports, file, m.types); err != nil {
+				return nil, err
+			}
+			svc.Methods = append(svc.Methods, m)
+		}
+	}
+
+	services := make([]*serviceType, 0, len(types))
+	for _, name := range types {
+		svc := wanted[name]
+		if len(svc.Methods) == 0 {
+			return nil, fmt.Errorf("type %s has no method to call", name)
+		}
+		sort.Slice(svc.Methods, func(i, j int) bool { return svc.Methods[i].Name < svc.Methods[j].Name })
+		services = append(services, svc)
+	}
+	paths := make([]string, 0, len(imports))
+	for path, name := range imports {
+		if name != "" {
+			path = name + " " + strconv.Quote(path)
+		} else {
+			path = strconv.Quote(path)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	err = clientTemplate.Execute(&buf, struct {
+		Header   string
+		Package  string
+		Imports  []string
+		Services []*serviceType
+	}{generatedHeader, pkg.Name, paths, services})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func isGenerated(file *ast.File) bool {
+	for _, c := range file.Comments {
+		if strings.HasPrefix(c.Text(), strings.TrimPrefix(generatedHeader, "// ")) {
+			return true
+		}
+	}
+	return false
+}
+
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// methodOf recognises the methods registered by service.registerMethods, except the streaming ones,
+// fd is declared in file
+func methodOf(file *ast.File, fd *ast.FuncDecl) (method, bool) {
+	results := fd.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 || exprString(results.List[0].Type) != "error" {
+		return method{}, false
+	}
+	var params []ast.Expr
+	for _, field := range fd.Type.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if ctx := contextType(file); len(params) == 3 && ctx != "" && exprString(params[0]) == ctx {
+		params = params[1:]
+	}
+	if len(params) != 2 {
+		return method{}, false
+	}
+	reply, ok := params[1].(*ast.StarExpr)
+	if !ok || isStream(params[0]) || isStream(params[1]) {
+		return method{}, false
+	}
+	if !isExportedOrBuiltinType(params[0]) || !isExportedOrBuiltinType(params[1]) {
+		return method{}, false
+	}
+	return method{
+		Name:      fd.Name.Name,
+		ArgType:   exprString(params[0]),
+		ReplyType: exprString(reply.X),
+		types:     params,
+	}, true
+}
+
+// contextType returns how file refers to context.Context, "" if file doesn't import context
+func contextType(file *ast.File) string {
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path != "context" {
+			continue
+		}
+		switch {
+		case spec.Name == nil:
+			return "context.Context"
+		case spec.Name.Name == ".":
+			return "Context"
+		case spec.Name.Name != "_":
+			return spec.Name.Name + ".Context"
+		}
+	}
+	return ""
+}
+
+// isExportedOrBuiltinType is the check of the server on the syntax: a type named in the package
+// must be exported unless it's predeclared, and the unnamed ones, such as pointers, pass
+func isExportedOrBuiltinType(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return true
+	}
+	return ident.IsExported() || types.Universe.Lookup(ident.Name) != nil
+}
+
+func isStream(expr ast.Expr) bool {
+	s := exprString(expr)
+	return s == "*ServerStream" || strings.HasSuffix(s, ".ServerStream")
+}
+
+func exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = format.Node(&buf, token.NewFileSet(), expr)
+	return buf.String()
+}
+
+// addImports adds the packages referred by exprs, looked up in the imports of file
+func addImports(imports map[string]string, file *ast.File, exprs []ast.Expr) error {
+	var err error
+	inspect := func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			if name != pkg.Name {
+				continue
+			}
+			if spec.Name != nil {
+				imports[path] = name
+			} else if _, ok := imports[path]; !ok {
+				imports[path] = ""
+			}
+			return false
+		}
+		err = errors.New("can't find the import of " + pkg.Name)
+		return false
+	}
+	for _, expr := range exprs {
+		ast.Inspect(expr, inspect)
+	}
+	return err
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`{{.Header}}
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range .Services}}
+// {{.Name}}Client is the typed client of service {{.Name}}
+type {{.Name}}Client struct {
+	c brpc.Caller
+}
+
+// New{{.Name}}Client returns a {{.Name}}Client making calls through c, such as a *brpc.Client or an *xclient.XClient
+func New{{.Name}}Client(c brpc.Caller) *{{.Name}}Client {
+	return &{{.Name}}Client{c: c}
+}
+{{$svc := .Name}}
+{{- range .Methods}}
+// {{.Name}} calls {{$svc}}.{{.Name}}
+func (c *{{$svc}}Client) {{.Name}}(ctx context.Context, args {{.ArgType}}) ({{.ReplyType}}, error) {
+	var reply {{.ReplyType}}
+	err := c.c.Call(ctx, "{{$svc}}.{{.Name}}", args, &reply)
+	return reply, err
+}
+{{end}}
+{{- end}}`))
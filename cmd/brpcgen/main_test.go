@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const serviceSrc = `package foo
+
+import (
+	"context"
+	"time"
+
+	"github.com/bswaterb/goX/brpc"
+)
+
+type Args struct{ Num1, Num2 int }
+
+type Foo struct{}
+
+func (f *Foo) Sum(args Args, reply *int) error { return nil }
+
+func (f Foo) Wait(ctx context.Context, d time.Duration, reply *bool) error { return nil }
+
+func (f *Foo) Tail(args Args, st *brpc.ServerStream) error { return nil }
+
+func (f *Foo) NoReply(args Args, reply int) error { return nil }
+
+func (f *Foo) unexported(args Args, reply *int) error { return nil }
+
+type hidden struct{}
+
+func (f *Foo) Hidden(args hidden, reply *int) error { return nil }
+
+type Bar struct{}
+`
+
+// barSrc imports context by another name
+const barSrc = `package foo
+
+import stdctx "context"
+
+func (f Foo) Ping(ctx stdctx.Context, args Args, reply *bool) error { return nil }
+
+func (b Bar) Echo(s string, reply *string) error { return nil }
+`
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "foo.go"), []byte(serviceSrc), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bar.go"), []byte(barSrc), 0644))
+
+	src, err := generate(dir, []string{"Foo"})
+	assert.NoError(t, err)
+	code := string(src)
+	assert.True(t, strings.HasPrefix(code, generatedHeader))
+	assert.Contains(t, code, "package foo")
+	assert.Contains(t, code, `"time"`)
+	assert.Contains(t, code, "func NewFooClient(c brpc.Caller) *FooClient")
+	assert.Contains(t, code, "func (c *FooClient) Sum(ctx context.Context, args Args) (int, error)")
+	assert.Contains(t, code, `c.c.Call(ctx, "Foo.Sum", args, &reply)`)
+	assert.Contains(t, code, "func (c *FooClient) Wait(ctx context.Context, args time.Duration) (bool, error)")
+	assert.Contains(t, code, "func (c *FooClient) Ping(ctx context.Context, args Args) (bool, error)")
+	assert.NotContains(t, code, "stdctx")
+	for _, skipped := range []string{"Tail", "NoReply", "unexported", "Hidden", "Bar"} {
+		assert.NotContains(t, code, skipped)
+	}
+
+	// the generated file is ignored when generating again
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "foo_brpc.go"), src, 0644))
+	again, err := generate(dir, []string{"Foo", "Bar"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(again), "func (c *BarClient) Echo(ctx context.Context, args string) (string, error)")
+
+	_, err = generate(dir, []string{"Baz"})
+	assert.Error(t, err)
+}